@@ -0,0 +1,215 @@
+// Package estest is Given/When/Then harness for aggregate tests. Scenario
+// applies past events, runs the command and compares uncommitted events by
+// reason and decoded payload.
+//
+//	payment := &PaymentAggregator{}
+//	payment.AggregateCluster = eventsourcing.New(payment, payment.Transition, eventsourcing.NanoidGenerator)
+//
+//	estest.New(t, payment).
+//		Given(estest.Event{Reason: "created", Payload: paymentCreated{Amount: 100}}).
+//		When(func() error { return payment.Refund(30) }).
+//		Then(estest.Event{Reason: "refunded", Payload: paymentRefunded{Amount: 30}})
+package estest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+// T is the subset of testing.TB used by Scenario.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Event is past or expected event. Expected event with nil payload is
+// compared by reason only. Given events are encoded with the serializer,
+// JSON if it's empty, expected event with the serializer is compared by it
+// as well.
+type Event struct {
+	Reason     string
+	Payload    interface{}
+	Serializer event.SerializerType
+}
+
+func (e Event) String() string {
+	if e.Serializer == "" {
+		return fmt.Sprintf("{Reason:%s Payload:%+v}", e.Reason, e.Payload)
+	}
+	return fmt.Sprintf("{Reason:%s Payload:%+v Serializer:%s}", e.Reason, e.Payload, e.Serializer)
+}
+
+// undecodedPayload stands for the payload which can't be decoded into the
+// type of the expected payload or into a generic value, e.g. an unexpected
+// event of a binary serializer.
+type undecodedPayload struct {
+	serializer event.SerializerType
+	payload    []byte
+	err        string
+}
+
+func (p undecodedPayload) String() string {
+	return fmt.Sprintf("<%s payload %x: %s>", p.serializer, p.payload, p.err)
+}
+
+// Scenario is a single aggregate test, it's not reusable.
+type Scenario struct {
+	t    T
+	agg  event.Aggregator
+	ran  bool
+	err  error
+	done bool
+}
+
+// New returns scenario of the aggregate, the aggregate must have no events.
+func New(t T, agg event.Aggregator) *Scenario {
+	return &Scenario{t: t, agg: agg}
+}
+
+// Given applies past events into the aggregate as committed ones.
+func (s *Scenario) Given(events ...Event) *Scenario {
+	s.t.Helper()
+	if s.ran {
+		s.t.Fatalf("estest: Given called after When")
+		return s
+	}
+
+	for _, e := range events {
+		serializer := e.Serializer
+		if serializer == "" {
+			serializer = event.SerializerTypeJSON
+		}
+		evt, err := event.NewWithSerializer(e.Reason, e.Payload, serializer)
+		if err != nil {
+			s.t.Fatalf("estest: cannot create given event %q: %v", e.Reason, err)
+			return s
+		}
+		evt.SetTenantId(s.agg.GetTenantId())
+		evt.SetAggregateId(s.agg.GetId())
+		evt.SetAggregateType(s.agg.GetType())
+		evt.SetVersion(s.agg.GetVersion() + event.NextVersion)
+
+		if err := s.agg.ApplyCommitted(evt); err != nil {
+			s.t.Fatalf("estest: cannot apply given event %q: %v", e.Reason, err)
+			return s
+		}
+	}
+	return s
+}
+
+// When runs the command, it's expected to apply new events into the
+// aggregate.
+func (s *Scenario) When(command func() error) *Scenario {
+	s.t.Helper()
+	if s.ran {
+		s.t.Fatalf("estest: When called twice")
+		return s
+	}
+
+	s.ran = true
+	s.err = command()
+	return s
+}
+
+// Then expects the command to succeed and apply exactly the events.
+func (s *Scenario) Then(expected ...Event) {
+	s.t.Helper()
+	if !s.check() {
+		return
+	}
+	if s.err != nil {
+		s.t.Errorf("estest: unexpected error: %v", s.err)
+		return
+	}
+
+	actual := decodeEvents(s.agg.ListUncommittedEvents(), expected)
+	if expected == nil {
+		expected = []Event{}
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		s.t.Errorf("estest: uncommitted events differ:\n%s", diffEvents(expected, actual))
+	}
+}
+
+// ThenError expects the command to fail with err, see errors.Is. Failed
+// command must not apply any events.
+func (s *Scenario) ThenError(err error) {
+	s.t.Helper()
+	if !s.check() {
+		return
+	}
+	if !errors.Is(s.err, err) {
+		s.t.Errorf("estest: expected error %v, got %v", err, s.err)
+		return
+	}
+	if events := s.agg.ListUncommittedEvents(); len(events) != 0 {
+		s.t.Errorf("estest: expected no events with error, got %d", len(events))
+	}
+}
+
+func (s *Scenario) check() bool {
+	if !s.ran {
+		s.t.Fatalf("estest: Then called without When")
+		return false
+	}
+	if s.done {
+		s.t.Fatalf("estest: scenario is already checked")
+		return false
+	}
+	s.done = true
+	return true
+}
+
+// diffEvents describes every position where expected and actual events
+// differ.
+func diffEvents(expected, actual []Event) string {
+	var b strings.Builder
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			fmt.Fprintf(&b, "\tevent %d: missing %+v\n", i, expected[i])
+		case i >= len(expected):
+			fmt.Fprintf(&b, "\tevent %d: unexpected %+v\n", i, actual[i])
+		case !reflect.DeepEqual(expected[i], actual[i]):
+			fmt.Fprintf(&b, "\tevent %d: expected %+v, got %+v\n", i, expected[i], actual[i])
+		}
+	}
+	return b.String()
+}
+
+// decodeEvents decodes payloads of events into types of expected payloads.
+// Events without expected counterpart are decoded into generic values.
+// Payloads which can't be decoded are kept undecoded, so they are reported
+// by the diff.
+func decodeEvents(events []event.Eventer, expected []Event) []Event {
+	decoded := make([]Event, len(events))
+	for i, evt := range events {
+		decoded[i].Reason = evt.GetReason()
+
+		var typ reflect.Type
+		if i < len(expected) {
+			if expected[i].Serializer != "" {
+				decoded[i].Serializer = evt.GetSerializer()
+			}
+			if expected[i].Payload == nil {
+				continue
+			}
+			typ = reflect.TypeOf(expected[i].Payload)
+		} else {
+			typ = reflect.TypeOf((*interface{})(nil)).Elem()
+		}
+
+		dst := reflect.New(typ)
+		if err := event.Decode(evt, dst.Interface()); err != nil {
+			decoded[i].Payload = undecodedPayload{serializer: evt.GetSerializer(), payload: evt.GetPayload(), err: err.Error()}
+			continue
+		}
+		decoded[i].Payload = dst.Elem().Interface()
+	}
+	return decoded
+}
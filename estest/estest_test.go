@@ -0,0 +1,188 @@
+package estest_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/estest"
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+type BalanceAggregator struct {
+	*eventsourcing.AggregateCluster
+	Balance int
+}
+
+type balanceChanged struct {
+	Amount int
+}
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+func newBalance() *BalanceAggregator {
+	agg := &BalanceAggregator{}
+	agg.AggregateCluster = eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	return agg
+}
+
+func (ba *BalanceAggregator) Transition(evt event.Eventer) error {
+	var payload balanceChanged
+	if err := event.Decode(evt, &payload); err != nil {
+		return err
+	}
+	switch evt.GetReason() {
+	case "deposited":
+		ba.Balance += payload.Amount
+	case "withdrawn":
+		ba.Balance -= payload.Amount
+	default:
+		return errors.New("undefined event type")
+	}
+	return nil
+}
+
+func (ba *BalanceAggregator) Withdraw(amount int) error {
+	if ba.Balance < amount {
+		return ErrInsufficientFunds
+	}
+	return ba.Apply(event.MustNew("withdrawn", balanceChanged{Amount: amount}))
+}
+
+// WithdrawWith withdraws amount with the event encoded by the serializer.
+func (ba *BalanceAggregator) WithdrawWith(amount int, serializer event.SerializerType) error {
+	evt, err := event.NewWithSerializer("withdrawn", balanceChanged{Amount: amount}, serializer)
+	if err != nil {
+		return err
+	}
+	return ba.Apply(evt)
+}
+
+// opaqueSerializer decodes payloads into *balanceChanged only, like binary
+// serializers which need the concrete type.
+type opaqueSerializer struct{}
+
+const serializerTypeOpaque event.SerializerType = "estest_opaque"
+
+func init() {
+	if err := event.RegisterSerializer(serializerTypeOpaque, opaqueSerializer{}); err != nil {
+		panic(err)
+	}
+}
+
+func (opaqueSerializer) Encode(v interface{}) (event.Payload, error) {
+	return json.Marshal(v)
+}
+
+func (opaqueSerializer) Decode(data event.Payload, dst interface{}) error {
+	if _, ok := dst.(*balanceChanged); !ok {
+		return errors.New("unknown payload type")
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func TestScenario(t *testing.T) {
+	balance := newBalance()
+	estest.New(t, balance).
+		Given(
+			estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 100}},
+			estest.Event{Reason: "withdrawn", Payload: balanceChanged{Amount: 20}},
+		).
+		When(func() error { return balance.Withdraw(30) }).
+		Then(estest.Event{Reason: "withdrawn", Payload: balanceChanged{Amount: 30}})
+	assert.Equal(t, 50, balance.Balance)
+
+	balance = newBalance()
+	estest.New(t, balance).
+		Given(estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 10}}).
+		When(func() error { return balance.Withdraw(30) }).
+		ThenError(ErrInsufficientFunds)
+
+	// Reason only comparison
+	balance = newBalance()
+	estest.New(t, balance).
+		Given(estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 10}}).
+		When(func() error { return balance.Withdraw(10) }).
+		Then(estest.Event{Reason: "withdrawn"})
+}
+
+type recorder struct {
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.fatal = true
+	r.Errorf(format, args...)
+}
+
+func TestScenarioFailures(t *testing.T) {
+	rec := &recorder{}
+	balance := newBalance()
+	estest.New(rec, balance).
+		Given(estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 100}}).
+		When(func() error { return balance.Withdraw(30) }).
+		Then(estest.Event{Reason: "withdrawn", Payload: balanceChanged{Amount: 40}})
+	assert.Len(t, rec.errors, 1)
+	assert.Contains(t, rec.errors[0], "event 0: expected {Reason:withdrawn Payload:{Amount:40}}, got {Reason:withdrawn Payload:{Amount:30}}")
+
+	rec = &recorder{}
+	balance = newBalance()
+	estest.New(rec, balance).
+		Given(estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 100}}).
+		When(func() error { return balance.Withdraw(30) }).
+		Then()
+	assert.Len(t, rec.errors, 1, "unexpected events must be reported")
+	assert.Contains(t, rec.errors[0], "event 0: unexpected {Reason:withdrawn")
+
+	rec = &recorder{}
+	balance = newBalance()
+	estest.New(rec, balance).
+		When(func() error { return balance.Withdraw(30) }).
+		Then(estest.Event{Reason: "withdrawn"})
+	assert.Equal(t, []string{"estest: unexpected error: insufficient funds"}, rec.errors)
+
+	rec = &recorder{}
+	estest.New(rec, newBalance()).
+		Given(estest.Event{Reason: "unknown", Payload: balanceChanged{}})
+	assert.True(t, rec.fatal, "given event must be applied")
+}
+
+func TestScenarioSerializers(t *testing.T) {
+	balance := newBalance()
+	estest.New(t, balance).
+		Given(estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 100}, Serializer: event.SerializerTypeMsgpack}).
+		When(func() error { return balance.WithdrawWith(30, event.SerializerTypeMsgpack) }).
+		Then(estest.Event{Reason: "withdrawn", Payload: balanceChanged{Amount: 30}, Serializer: event.SerializerTypeMsgpack})
+	assert.Equal(t, 70, balance.Balance)
+
+	rec := &recorder{}
+	balance = newBalance()
+	estest.New(rec, balance).
+		Given(estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 100}}).
+		When(func() error { return balance.WithdrawWith(30, event.SerializerTypeCBOR) }).
+		Then(estest.Event{Reason: "withdrawn", Payload: balanceChanged{Amount: 30}, Serializer: event.SerializerTypeMsgpack})
+	assert.Len(t, rec.errors, 1, "serializer must be compared")
+	assert.Contains(t, rec.errors[0], "got {Reason:withdrawn Payload:{Amount:30} Serializer:cbor}")
+
+	// Unexpected events which can't be decoded are reported undecoded
+	rec = &recorder{}
+	balance = newBalance()
+	estest.New(rec, balance).
+		Given(estest.Event{Reason: "deposited", Payload: balanceChanged{Amount: 100}}).
+		When(func() error { return balance.WithdrawWith(30, serializerTypeOpaque) }).
+		Then()
+	assert.Len(t, rec.errors, 1, "unexpected events must be reported")
+	assert.Contains(t, rec.errors[0], "event 0: unexpected {Reason:withdrawn Payload:<estest_opaque payload")
+	assert.Contains(t, rec.errors[0], "unknown payload type>}")
+}
@@ -0,0 +1,214 @@
+package event
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression represents payload compression algorithm.
+type Compression string
+
+const (
+	CompressionNone   Compression = "none"
+	CompressionGzip   Compression = "gzip"
+	CompressionZstd   Compression = "zstd"
+	CompressionSnappy Compression = "snappy"
+)
+
+// compressionCodes are written as the first byte of the compressed payload,
+// so the payload can be decoded regardless of current configuration.
+var compressionCodes = map[Compression]byte{
+	CompressionNone:   0,
+	CompressionGzip:   1,
+	CompressionZstd:   2,
+	CompressionSnappy: 3,
+}
+
+// DefaultMaxDecompressedSize limits size of decompressed payloads, so a
+// small corrupted or crafted payload cannot exhaust memory.
+const DefaultMaxDecompressedSize = 64 << 20
+
+var (
+	ErrUnsupportedCompression = errors.New("unsupported compression")
+	ErrCorruptedPayload       = errors.New("corrupted payload")
+	ErrPayloadTooLarge        = errors.New("decompressed payload is too large")
+)
+
+// CompressedSerializerType returns serializer type recorded for events
+// encoded with compressing serializer, e.g. "json+zstd". Such types
+// are distinct from the plain ones, so old uncompressed rows are still
+// decoded with the plain serializer.
+func CompressedSerializerType(typ SerializerType, compression Compression) SerializerType {
+	return typ + "+" + SerializerType(compression)
+}
+
+// CompressingSerializer wraps any Serializer and compresses encoded
+// payloads which size is at least threshold bytes. Smaller payloads are
+// stored as is, because compression does not pay off for them.
+type CompressingSerializer struct {
+	serializer  Serializer
+	compression Compression
+	threshold   int
+	maxSize     int64
+}
+
+var _ (Serializer) = &CompressingSerializer{}
+
+func NewCompressingSerializer(s Serializer, compression Compression, threshold int) (*CompressingSerializer, error) {
+	if _, ok := compressionCodes[compression]; !ok {
+		return nil, ErrUnsupportedCompression
+	}
+	return &CompressingSerializer{
+		serializer:  s,
+		compression: compression,
+		threshold:   threshold,
+		maxSize:     DefaultMaxDecompressedSize,
+	}, nil
+}
+
+// SetMaxDecompressedSize sets maximum size of decompressed payload. Decode
+// fails with ErrPayloadTooLarge when payload decompresses to more bytes.
+func (s *CompressingSerializer) SetMaxDecompressedSize(size int64) {
+	s.maxSize = size
+}
+
+// RegisterCompressingSerializer wraps serializer registered for typ and
+// registers it under CompressedSerializerType(typ, compression).
+func RegisterCompressingSerializer(typ SerializerType, compression Compression, threshold int) (SerializerType, error) {
+	s, ok := LookupSerializer(typ)
+	if !ok {
+		return "", ErrUnsupportedSerializer
+	}
+
+	cs, err := NewCompressingSerializer(s, compression, threshold)
+	if err != nil {
+		return "", err
+	}
+
+	compressedType := CompressedSerializerType(typ, compression)
+	return compressedType, RegisterSerializer(compressedType, cs)
+}
+
+func (s *CompressingSerializer) Encode(v interface{}) (Payload, error) {
+	data, err := s.serializer.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	compression := s.compression
+	if len(data) < s.threshold {
+		compression = CompressionNone
+	}
+
+	compressed, err := compress(compression, data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{compressionCodes[compression]}, compressed...), nil
+}
+
+func (s *CompressingSerializer) Decode(data Payload, dst interface{}) error {
+	if len(data) == 0 {
+		return ErrCorruptedPayload
+	}
+
+	for compression, code := range compressionCodes {
+		if code == data[0] {
+			decompressed, err := decompress(compression, data[1:], s.maxSize)
+			if err != nil {
+				return err
+			}
+			return s.serializer.Decode(decompressed, dst)
+		}
+	}
+	return ErrUnsupportedCompression
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdErr
+}
+
+func compress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	}
+	return nil, ErrUnsupportedCompression
+}
+
+func decompress(compression Compression, data []byte, maxSize int64) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readLimited(r, maxSize)
+	case CompressionZstd:
+		r, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readLimited(r, maxSize)
+	case CompressionSnappy:
+		// Block format records decoded length up front
+		size, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if int64(size) > maxSize {
+			return nil, ErrPayloadTooLarge
+		}
+		return snappy.Decode(nil, data)
+	}
+	return nil, ErrUnsupportedCompression
+}
+
+// readLimited reads r to the end, failing once more than maxSize bytes
+// are read.
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrPayloadTooLarge
+	}
+	return data, nil
+}
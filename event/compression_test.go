@@ -0,0 +1,93 @@
+package event
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressingSerializer(t *testing.T) {
+	large := newSerializerTestPayload()
+	large.PaymentStatus = strings.Repeat("created", 128)
+	small := newSerializerTestPayload()
+
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd, CompressionSnappy} {
+		t.Run(string(compression), func(t *testing.T) {
+			s, err := NewCompressingSerializer(JSONSerializer{}, compression, 256)
+			assert.NoError(t, err, "failed to create serializer")
+
+			plain, _ := JSONSerializer{}.Encode(large)
+			data, err := s.Encode(large)
+			assert.NoError(t, err, "failed to encode")
+			assert.Equal(t, compressionCodes[compression], data[0])
+			assert.Less(t, len(data), len(plain), "payload is not compressed")
+
+			var dst serializerTestPayload
+			assert.NoError(t, s.Decode(data, &dst), "failed to decode")
+			assert.Equal(t, large, dst)
+
+			// Payload below threshold is not compressed
+			data, err = s.Encode(small)
+			assert.NoError(t, err, "failed to encode")
+			assert.Equal(t, compressionCodes[CompressionNone], data[0])
+
+			dst = serializerTestPayload{}
+			assert.NoError(t, s.Decode(data, &dst), "failed to decode")
+			assert.Equal(t, small, dst)
+		})
+	}
+}
+
+func TestCompressingSerializerDecodesOtherAlgorithms(t *testing.T) {
+	gzipSerializer, _ := NewCompressingSerializer(JSONSerializer{}, CompressionGzip, 0)
+	zstdSerializer, _ := NewCompressingSerializer(JSONSerializer{}, CompressionZstd, 0)
+
+	payload := newSerializerTestPayload()
+	data, err := gzipSerializer.Encode(payload)
+	assert.NoError(t, err, "failed to encode")
+
+	var dst serializerTestPayload
+	assert.NoError(t, zstdSerializer.Decode(data, &dst), "failed to decode")
+	assert.Equal(t, payload, dst)
+}
+
+func TestCompressingSerializerMaxDecompressedSize(t *testing.T) {
+	payload := newSerializerTestPayload()
+	payload.PaymentStatus = strings.Repeat("created", 128)
+
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd, CompressionSnappy} {
+		t.Run(string(compression), func(t *testing.T) {
+			s, err := NewCompressingSerializer(JSONSerializer{}, compression, 0)
+			assert.NoError(t, err, "failed to create serializer")
+
+			data, err := s.Encode(payload)
+			assert.NoError(t, err, "failed to encode")
+
+			s.SetMaxDecompressedSize(256)
+			var dst serializerTestPayload
+			assert.Equal(t, ErrPayloadTooLarge, s.Decode(data, &dst))
+
+			s.SetMaxDecompressedSize(DefaultMaxDecompressedSize)
+			assert.NoError(t, s.Decode(data, &dst), "failed to decode")
+			assert.Equal(t, payload, dst)
+		})
+	}
+}
+
+func TestRegisterCompressingSerializer(t *testing.T) {
+	typ, err := RegisterCompressingSerializer(SerializerTypeMsgpack, CompressionSnappy, 0)
+	assert.NoError(t, err, "failed to register serializer")
+	assert.Equal(t, SerializerType("msgpack+snappy"), typ)
+
+	payload := newSerializerTestPayload()
+	evt, err := NewWithSerializer("created", payload, typ)
+	assert.NoError(t, err, "failed to create event")
+
+	var dst serializerTestPayload
+	assert.NoError(t, Decode(evt, &dst), "failed to decode")
+	assert.Equal(t, payload, dst)
+
+	_, err = NewCompressingSerializer(JSONSerializer{}, "lz4", 0)
+	assert.Equal(t, ErrUnsupportedCompression, err)
+}
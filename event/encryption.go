@@ -0,0 +1,360 @@
+package event
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyProvider provides key encryption keys (KEK). Every key is identified
+// by id, which is stored together with each encrypted payload, so keys can
+// be rotated without re-encryption of already saved events.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new payloads.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key by its id to decrypt already saved payloads.
+	Key(id string) ([]byte, error)
+}
+
+var (
+	ErrKeyNotFound  = errors.New("encryption key not found")
+	ErrDecryption   = errors.New("payload decryption failed")
+	ErrBoundPayload = errors.New("payload is bound to event, it's decrypted by DecryptEvent")
+)
+
+// First byte of every encrypted payload. Payloads encrypted by Encode are
+// not bound to any event, payloads bound by BindEncryption are sealed with
+// associated data of the event identity.
+const (
+	encryptionVersion      byte = 1
+	boundEncryptionVersion byte = 2
+)
+
+// EncryptedSerializerType returns serializer type recorded for events
+// encoded with encrypting serializer, e.g. "json+enc".
+func EncryptedSerializerType(typ SerializerType) SerializerType {
+	return typ + "+enc"
+}
+
+// EncryptingSerializer encrypts payloads encoded by another serializer
+// with AES-GCM using envelope encryption: each payload is encrypted with
+// a random data key, which is encrypted by the key encryption key of
+// KeyProvider. Encrypted payload layout is:
+//
+//	version | len(key id) | key id | len(data key) | encrypted data key | encrypted payload
+//
+// Stores bind encrypted payloads to their events on save, see
+// BindEncryption, and decrypt them on read.
+type EncryptingSerializer struct {
+	typ        SerializerType
+	serializer Serializer
+	keys       KeyProvider
+}
+
+var _ (Serializer) = &EncryptingSerializer{}
+
+// NewEncryptingSerializer wraps serializer registered for typ.
+func NewEncryptingSerializer(typ SerializerType, keys KeyProvider) (*EncryptingSerializer, error) {
+	s, ok := LookupSerializer(typ)
+	if !ok {
+		return nil, ErrUnsupportedSerializer
+	}
+	return &EncryptingSerializer{typ: typ, serializer: s, keys: keys}, nil
+}
+
+// RegisterEncryptingSerializer wraps serializer registered for typ and
+// registers it under EncryptedSerializerType(typ).
+func RegisterEncryptingSerializer(typ SerializerType, keys KeyProvider) (SerializerType, error) {
+	s, err := NewEncryptingSerializer(typ, keys)
+	if err != nil {
+		return "", err
+	}
+
+	encryptedType := EncryptedSerializerType(typ)
+	return encryptedType, RegisterSerializer(encryptedType, s)
+}
+
+func (s *EncryptingSerializer) Encode(v interface{}) (Payload, error) {
+	data, err := s.serializer.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.Encrypt(data)
+}
+
+func (s *EncryptingSerializer) Decode(data Payload, dst interface{}) error {
+	decrypted, err := s.Decrypt(data)
+	if err != nil {
+		return err
+	}
+	return s.serializer.Decode(decrypted, dst)
+}
+
+// Encrypt encrypts already encoded payload with the current key.
+func (s *EncryptingSerializer) Encrypt(data Payload) (Payload, error) {
+	return s.encrypt(encryptionVersion, data, nil)
+}
+
+func (s *EncryptingSerializer) encrypt(version byte, data Payload, additional []byte) (Payload, error) {
+	keyId, kek, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(keyId) > 255 {
+		return nil, errors.New("encryption key id is too long")
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	wrappedDek, err := seal(kek, dek, []byte(keyId))
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dek, data, additional)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 4+len(keyId)+len(wrappedDek)+len(ciphertext))
+	out = append(out, version, byte(len(keyId)))
+	out = append(out, keyId...)
+	out = append(out, 0, 0)
+	binary.BigEndian.PutUint16(out[len(out)-2:], uint16(len(wrappedDek)))
+	out = append(out, wrappedDek...)
+	out = append(out, ciphertext...)
+	return out, nil
+}
+
+// Decrypt decrypts payload with the key it was encrypted with. Payloads
+// bound to events are rejected with ErrBoundPayload.
+func (s *EncryptingSerializer) Decrypt(data Payload) (Payload, error) {
+	if len(data) != 0 && data[0] == boundEncryptionVersion {
+		return nil, ErrBoundPayload
+	}
+	return s.decrypt(data, nil)
+}
+
+func (s *EncryptingSerializer) decrypt(data Payload, additional []byte) (Payload, error) {
+	keyId, wrappedDek, ciphertext, err := splitEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, err := s.keys.Key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := open(kek, wrappedDek, []byte(keyId))
+	if err != nil {
+		return nil, err
+	}
+	return open(dek, ciphertext, additional)
+}
+
+// EncryptionKeyID returns id of the key the payload was encrypted with.
+func EncryptionKeyID(data Payload) (string, error) {
+	keyId, _, _, err := splitEnvelope(data)
+	return keyId, err
+}
+
+// BindEncryption re-encrypts payload of the event encoded with encrypting
+// serializer with associated data of the event identity: tenant, aggregate
+// id, aggregate type and version. Bound payload is decrypted only as the
+// payload of the same event, so it can't be moved into another row
+// unnoticed. Already bound payloads are only checked to belong to the event.
+// Events which are not encrypted are left untouched.
+func BindEncryption(evt Eventer) error {
+	es, ok := encryptingSerializerOf(evt)
+	if !ok || len(evt.GetPayload()) == 0 {
+		return nil
+	}
+
+	data := evt.GetPayload()
+	if data[0] == boundEncryptionVersion {
+		_, err := es.decrypt(data, encryptionAAD(evt))
+		return err
+	}
+
+	decrypted, err := es.Decrypt(data)
+	if err != nil {
+		return err
+	}
+	bound, err := es.encrypt(boundEncryptionVersion, decrypted, encryptionAAD(evt))
+	if err != nil {
+		return err
+	}
+	evt.SetPayload(bound)
+	return nil
+}
+
+// DecryptEvent replaces encrypted event payload with the decrypted one and
+// restores the serializer type it was encoded with. Bound payloads are
+// decrypted only if they belong to the event, see BindEncryption. Events
+// which are not encrypted are left untouched.
+func DecryptEvent(evt Eventer) error {
+	es, ok := encryptingSerializerOf(evt)
+	if !ok || len(evt.GetPayload()) == 0 {
+		return nil
+	}
+
+	var additional []byte
+	if evt.GetPayload()[0] == boundEncryptionVersion {
+		additional = encryptionAAD(evt)
+	}
+	decrypted, err := es.decrypt(evt.GetPayload(), additional)
+	if err != nil {
+		return err
+	}
+	evt.SetPayload(decrypted)
+	evt.SetSerializer(es.typ)
+	return nil
+}
+
+func encryptingSerializerOf(evt Eventer) (*EncryptingSerializer, bool) {
+	s, ok := LookupSerializer(evt.GetSerializer())
+	if !ok {
+		return nil, false
+	}
+	es, ok := s.(*EncryptingSerializer)
+	return es, ok
+}
+
+// encryptionAAD returns associated data of bound payloads, strings are
+// prefixed with their length, so identities can't be shifted into each other.
+func encryptionAAD(evt Eventer) []byte {
+	var aad []byte
+	for _, s := range []string{evt.GetTenantId(), evt.GetAggregateId(), evt.GetAggregateType()} {
+		aad = binary.AppendUvarint(aad, uint64(len(s)))
+		aad = append(aad, s...)
+	}
+	return binary.BigEndian.AppendUint64(aad, uint64(evt.GetVersion()))
+}
+
+func splitEnvelope(data Payload) (keyId string, wrappedDek, ciphertext []byte, err error) {
+	if len(data) < 2 || (data[0] != encryptionVersion && data[0] != boundEncryptionVersion) {
+		return "", nil, nil, ErrCorruptedPayload
+	}
+	n := int(data[1])
+	data = data[2:]
+	if len(data) < n+2 {
+		return "", nil, nil, ErrCorruptedPayload
+	}
+	keyId, data = string(data[:n]), data[n:]
+
+	n = int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < n {
+		return "", nil, nil, ErrCorruptedPayload
+	}
+	return keyId, data[:n], data[n:], nil
+}
+
+// seal encrypts plaintext with AES-GCM, random nonce is prepended to
+// the ciphertext.
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, ciphertext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrCorruptedPayload
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// FileKeyProvider is a KeyProvider which loads keys from a directory. Every
+// key is stored in "<id>.key" file as base64 encoded 16, 24 or 32 bytes.
+type FileKeyProvider struct {
+	currentId string
+	keys      map[string][]byte
+}
+
+var _ (KeyProvider) = &FileKeyProvider{}
+
+// NewFileKeyProvider loads all keys from dir, new payloads are encrypted
+// with the key currentId.
+func NewFileKeyProvider(dir string, currentId string) (*FileKeyProvider, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, err
+		}
+		keys[strings.TrimSuffix(filepath.Base(path), ".key")] = key
+	}
+
+	if _, ok := keys[currentId]; !ok {
+		return nil, ErrKeyNotFound
+	}
+	return &FileKeyProvider{currentId: currentId, keys: keys}, nil
+}
+
+// WriteKeyFile generates a new random 32 bytes key and writes it to dir.
+func WriteKeyFile(dir string, id string) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	data := []byte(base64.StdEncoding.EncodeToString(key))
+	return os.WriteFile(filepath.Join(dir, id+".key"), data, os.FileMode(0600))
+}
+
+func (p *FileKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.currentId, p.keys[p.currentId], nil
+}
+
+func (p *FileKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
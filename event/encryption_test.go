@@ -0,0 +1,130 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeyProvider(t *testing.T, current string, ids ...string) *FileKeyProvider {
+	dir := t.TempDir()
+	for _, id := range ids {
+		assert.NoError(t, WriteKeyFile(dir, id), "failed to write key file")
+	}
+	p, err := NewFileKeyProvider(dir, current)
+	assert.NoError(t, err, "failed to load keys")
+	return p
+}
+
+func TestEncryptingSerializer(t *testing.T) {
+	keys := newTestKeyProvider(t, "key_0", "key_0")
+	s, err := NewEncryptingSerializer(SerializerTypeJSON, keys)
+	assert.NoError(t, err, "failed to create serializer")
+
+	payload := newSerializerTestPayload()
+	data, err := s.Encode(payload)
+	assert.NoError(t, err, "failed to encode")
+	assert.NotContains(t, string(data), payload.PaymentID, "payload is not encrypted")
+
+	keyId, err := EncryptionKeyID(data)
+	assert.NoError(t, err, "failed to get key id")
+	assert.Equal(t, "key_0", keyId)
+
+	var dst serializerTestPayload
+	assert.NoError(t, s.Decode(data, &dst), "failed to decode")
+	assert.Equal(t, payload, dst)
+
+	// Tampered payload
+	data[len(data)-1] ^= 0xff
+	assert.Equal(t, ErrDecryption, s.Decode(data, &dst))
+}
+
+func TestEncryptingSerializerKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, WriteKeyFile(dir, "key_0"))
+
+	oldKeys, err := NewFileKeyProvider(dir, "key_0")
+	assert.NoError(t, err, "failed to load keys")
+	oldSerializer, _ := NewEncryptingSerializer(SerializerTypeJSON, oldKeys)
+
+	payload := newSerializerTestPayload()
+	data, err := oldSerializer.Encode(payload)
+	assert.NoError(t, err, "failed to encode")
+
+	assert.NoError(t, WriteKeyFile(dir, "key_1"))
+	newKeys, err := NewFileKeyProvider(dir, "key_1")
+	assert.NoError(t, err, "failed to load keys")
+	newSerializer, _ := NewEncryptingSerializer(SerializerTypeJSON, newKeys)
+
+	var dst serializerTestPayload
+	assert.NoError(t, newSerializer.Decode(data, &dst), "failed to decode with rotated keys")
+	assert.Equal(t, payload, dst)
+
+	data, err = newSerializer.Encode(payload)
+	assert.NoError(t, err, "failed to encode")
+	keyId, _ := EncryptionKeyID(data)
+	assert.Equal(t, "key_1", keyId)
+
+	_, err = NewFileKeyProvider(dir, "key_2")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDecryptEvent(t *testing.T) {
+	keys := newTestKeyProvider(t, "key_0", "key_0")
+	typ, err := RegisterEncryptingSerializer(SerializerTypeCBOR, keys)
+	assert.NoError(t, err, "failed to register serializer")
+	assert.Equal(t, SerializerType("cbor+enc"), typ)
+
+	payload := newSerializerTestPayload()
+	evt, err := NewWithSerializer("created", payload, typ)
+	assert.NoError(t, err, "failed to create event")
+
+	assert.NoError(t, DecryptEvent(evt), "failed to decrypt event")
+	assert.Equal(t, SerializerTypeCBOR, evt.GetSerializer())
+
+	var dst serializerTestPayload
+	assert.NoError(t, Decode(evt, &dst), "failed to decode")
+	assert.Equal(t, payload, dst)
+}
+
+func TestBindEncryption(t *testing.T) {
+	keys := newTestKeyProvider(t, "key_0", "key_0")
+	typ, err := RegisterEncryptingSerializer(SerializerTypeMsgpack, keys)
+	assert.NoError(t, err, "failed to register serializer")
+
+	payload := newSerializerTestPayload()
+	newEvent := func(version Version) *Event {
+		evt, err := NewWithSerializer("created", payload, typ)
+		assert.NoError(t, err, "failed to create event")
+		evt.SetTenantId("tenant_a")
+		evt.SetAggregateId("agg_0")
+		evt.SetAggregateType("Payment")
+		evt.SetVersion(version)
+		return evt
+	}
+
+	evt := newEvent(1)
+	assert.NoError(t, BindEncryption(evt), "failed to bind payload")
+	bound := evt.GetPayload()
+	assert.NoError(t, BindEncryption(evt), "bound payload must be kept")
+	assert.Equal(t, bound, evt.GetPayload())
+
+	var dst serializerTestPayload
+	assert.Equal(t, ErrBoundPayload, Decode(evt, &dst))
+
+	// Payload moved into another event is not decrypted
+	other := newEvent(2)
+	other.SetPayload(append(Payload(nil), bound...))
+	assert.Equal(t, ErrDecryption, BindEncryption(other))
+	assert.Equal(t, ErrDecryption, DecryptEvent(other))
+
+	other = newEvent(1)
+	other.SetTenantId("tenant_b")
+	other.SetPayload(append(Payload(nil), bound...))
+	assert.Equal(t, ErrDecryption, DecryptEvent(other))
+
+	assert.NoError(t, DecryptEvent(evt), "failed to decrypt event")
+	assert.Equal(t, SerializerTypeMsgpack, evt.GetSerializer())
+	assert.NoError(t, Decode(evt, &dst), "failed to decode")
+	assert.Equal(t, payload, dst)
+}
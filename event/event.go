@@ -3,13 +3,15 @@ package event
 import (
 	"database/sql/driver"
 	"encoding/json"
-	"errors"
+	"strconv"
 	"time"
 )
 
 // Eventer is a main interface with all basic getters/setters
 // that responsibles for event manipulation.
 type Eventer interface {
+	GetTenantId() string
+	SetTenantId(id string)
 	GetAggregateId() string
 	SetAggregateId(id string)
 	GetAggregateType() string
@@ -24,6 +26,16 @@ type Eventer interface {
 	SetPayload(payload Payload)
 	GetSerializer() SerializerType
 	SetSerializer(s SerializerType)
+	GetIdempotencyKey() string
+	SetIdempotencyKey(key string)
+	GetHash() Hash
+	SetHash(hash Hash)
+	GetPrevHash() Hash
+	SetPrevHash(hash Hash)
+	GetMetadata() Metadata
+	SetMetadata(metadata Metadata)
+	GetSignature() Signature
+	SetSignature(signature Signature)
 }
 
 // Version represents event version.
@@ -51,7 +63,12 @@ func (t Timestamp) Value() (driver.Value, error) {
 // Payload represents an event payload (sequence of bytes).
 type Payload []byte
 
+// Metadata represents arbitrary key-value pairs attached to an event,
+// e.g. correlation id or trace context.
+type Metadata map[string]string
+
 type Event struct {
+	tenantId       string
 	aggregateId    string
 	aggregateType  string
 	reason         string
@@ -59,6 +76,11 @@ type Event struct {
 	tstamp         Timestamp
 	payload        Payload
 	serializerType SerializerType
+	idempotencyKey string
+	hash           Hash
+	prevHash       Hash
+	metadata       Metadata
+	signature      Signature
 }
 
 var _ (Eventer) = &Event{}
@@ -78,9 +100,9 @@ func New(reason string, payload interface{}) (*Event, error) {
 }
 
 func NewWithSerializer(reason string, payload interface{}, serializerType SerializerType) (*Event, error) {
-	s, ok := MatchedSerializers[serializerType]
+	s, ok := LookupSerializer(serializerType)
 	if !ok {
-		return nil, errors.New("unsupported serializer")
+		return nil, ErrUnsupportedSerializer
 	}
 
 	data, err := s.Encode(payload)
@@ -103,6 +125,16 @@ func MustNew(reason string, payload interface{}) *Event {
 	return event
 }
 
+// GetTenantId returns id of the tenant event belongs to. Empty id means
+// the default tenant.
+func (evt *Event) GetTenantId() string {
+	return evt.tenantId
+}
+
+func (evt *Event) SetTenantId(tenantId string) {
+	evt.tenantId = tenantId
+}
+
 func (evt *Event) GetAggregateId() string {
 	return evt.aggregateId
 }
@@ -159,6 +191,61 @@ func (evt *Event) SetSerializer(typ SerializerType) {
 	evt.serializerType = typ
 }
 
+// GetIdempotencyKey returns client-supplied deduplication key. Empty key
+// means that the event is not deduplicated.
+func (evt *Event) GetIdempotencyKey() string {
+	return evt.idempotencyKey
+}
+
+func (evt *Event) SetIdempotencyKey(key string) {
+	evt.idempotencyKey = key
+}
+
+// GetHash returns the event hash computed by event store when the
+// event is saved.
+func (evt *Event) GetHash() Hash {
+	return evt.hash
+}
+
+func (evt *Event) SetHash(hash Hash) {
+	evt.hash = hash
+}
+
+// GetPrevHash returns hash of the previous event in the stream.
+func (evt *Event) GetPrevHash() Hash {
+	return evt.prevHash
+}
+
+func (evt *Event) SetPrevHash(hash Hash) {
+	evt.prevHash = hash
+}
+
+func (evt *Event) GetMetadata() Metadata {
+	return evt.metadata
+}
+
+func (evt *Event) SetMetadata(metadata Metadata) {
+	evt.metadata = metadata
+}
+
+// GetSignature returns the event signature, zero Signature means that
+// the event is not signed.
+func (evt *Event) GetSignature() Signature {
+	return evt.signature
+}
+
+func (evt *Event) SetSignature(signature Signature) {
+	evt.signature = signature
+}
+
+// SetBatchIdempotencyKey derives idempotency keys for every event of the
+// batch from single key, so the whole batch is deduplicated at once.
+func SetBatchIdempotencyKey(events []Eventer, key string) {
+	for i, evt := range events {
+		evt.SetIdempotencyKey(key + "/" + strconv.Itoa(i))
+	}
+}
+
 func Covarience(events []*Event) []Eventer {
 	p := make([]Eventer, len(events))
 	for i, evt := range events {
@@ -170,6 +257,10 @@ func Covarience(events []*Event) []Eventer {
 // Aggregator is main interface that responsibles for event aggregation.
 // Aggregate is a cluster of associated objects treated as a single unit.
 type Aggregator interface {
+	// GetTenantId gets id of tenant aggregate root belongs to.
+	GetTenantId() string
+	// SetTenantId sets id of tenant aggregate root belongs to.
+	SetTenantId(id string)
 	// GetID gets aggregate root id.
 	GetId() string
 	// SetID sets aggregate root id.
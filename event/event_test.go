@@ -10,3 +10,10 @@ func TestNewWithSerializerUndefined(t *testing.T) {
 	_, err := NewWithSerializer("created", struct{}{}, "undefined")
 	assert.EqualError(t, err, "unsupported serializer")
 }
+
+func TestSetBatchIdempotencyKey(t *testing.T) {
+	events := []Eventer{MustNew("created", struct{}{}), MustNew("confirmed", struct{}{})}
+	SetBatchIdempotencyKey(events, "request_0")
+	assert.Equal(t, "request_0/0", events[0].GetIdempotencyKey())
+	assert.Equal(t, "request_0/1", events[1].GetIdempotencyKey())
+}
@@ -0,0 +1,74 @@
+package event
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// tenantMarker precedes tenant id in canonical encoding.
+const tenantMarker = math.MaxUint64
+
+// Hash represents a hash of the event chained with the previous event hash
+// of the same stream.
+type Hash []byte
+
+// Canonical returns deterministic binary encoding of the event content. Every
+// field is length prefixed, timestamp is encoded in microseconds, as it is
+// stored by databases, stores truncate finer timestamps before events are
+// hashed. Metadata is appended sorted by keys only when it is
+// not empty, so encoding of events without metadata never changes. Tenant id
+// is prepended only when it is not empty, after the tenantMarker which is
+// never a valid field length, so events of the default tenant keep their
+// encoding and events of different tenants never share it.
+func Canonical(evt Eventer) []byte {
+	var buf []byte
+	if tenantId := evt.GetTenantId(); tenantId != "" {
+		buf = appendUint64(buf, tenantMarker)
+		buf = appendField(buf, []byte(tenantId))
+	}
+	buf = appendField(buf, []byte(evt.GetAggregateId()))
+	buf = appendField(buf, []byte(evt.GetAggregateType()))
+	buf = appendField(buf, []byte(evt.GetReason()))
+	buf = appendUint64(buf, uint64(evt.GetVersion()))
+	buf = appendUint64(buf, uint64(time.Time(evt.GetTimestamp()).UnixMicro()))
+	buf = appendField(buf, evt.GetPayload())
+	buf = appendField(buf, []byte(evt.GetSerializer()))
+
+	if metadata := evt.GetMetadata(); len(metadata) != 0 {
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf = appendUint64(buf, uint64(len(keys)))
+		for _, key := range keys {
+			buf = appendField(buf, []byte(key))
+			buf = appendField(buf, []byte(metadata[key]))
+		}
+	}
+	return buf
+}
+
+// ChainHash returns SHA-256 hash of the previous event hash and
+// canonical encoding of the event.
+func ChainHash(prev Hash, evt Eventer) Hash {
+	h := sha256.New()
+	h.Write(appendField(nil, prev))
+	h.Write(Canonical(evt))
+	return h.Sum(nil)
+}
+
+func appendField(buf []byte, field []byte) []byte {
+	buf = appendUint64(buf, uint64(len(field)))
+	return append(buf, field...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
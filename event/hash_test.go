@@ -0,0 +1,43 @@
+package event
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainHash(t *testing.T) {
+	evt := MustNew("created", struct{ Status string }{Status: "Created"})
+	evt.SetAggregateId("agg_0")
+	evt.SetAggregateType("TestAggregator")
+	evt.SetVersion(1)
+
+	hash := ChainHash(nil, evt)
+	assert.Equal(t, 32, len(hash))
+	assert.Equal(t, hash, ChainHash(nil, evt), "hash must be deterministic")
+	assert.NotEqual(t, hash, ChainHash(hash, evt), "hash must depend on previous hash")
+
+	// Timestamp is hashed with microsecond precision, as stored by databases
+	evt.SetTimestamp(Timestamp(time.Time(evt.GetTimestamp()).Truncate(time.Microsecond)))
+	assert.Equal(t, hash, ChainHash(nil, evt))
+
+	evt.SetPayload(Payload(`{"Status":"Confirmed"}`))
+	assert.NotEqual(t, hash, ChainHash(nil, evt), "hash must depend on payload")
+}
+
+func TestCanonicalTenant(t *testing.T) {
+	evt := MustNew("created", struct{ Status string }{Status: "Created"})
+	evt.SetAggregateId("agg_0")
+	evt.SetAggregateType("TestAggregator")
+	evt.SetVersion(1)
+
+	canonical := Canonical(evt)
+	evt.SetTenantId("tenant_a")
+	assert.NotEqual(t, canonical, Canonical(evt), "encoding must depend on tenant")
+	assert.Equal(t, canonical, Canonical(evt)[len(Canonical(evt))-len(canonical):], "default tenant encoding must not change")
+
+	tenantA := Canonical(evt)
+	evt.SetTenantId("tenant_b")
+	assert.NotEqual(t, tenantA, Canonical(evt))
+}
@@ -0,0 +1,67 @@
+package event
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+var ErrNotProtoMessage = errors.New("value is not a proto.Message")
+
+// ProtobufSerializer encodes proto.Message payloads. The message is wrapped
+// into google.protobuf.Any, so the fully qualified message name is stored
+// together with the payload and the event can be decoded without guessing
+// its type.
+type ProtobufSerializer struct{}
+
+func (ProtobufSerializer) Encode(v interface{}) (Payload, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+
+	wrapped, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(wrapped)
+}
+
+// Decode decodes payload into dst. Decoding fails if dst message type
+// does not match the recorded message name.
+func (ProtobufSerializer) Decode(data Payload, dst interface{}) error {
+	if err := checkDecodeTarget(dst); err != nil {
+		return err
+	}
+	msg, ok := dst.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+
+	wrapped := new(anypb.Any)
+	if err := proto.Unmarshal(data, wrapped); err != nil {
+		return err
+	}
+	return wrapped.UnmarshalTo(msg)
+}
+
+// DecodeMessage decodes payload into a new message of the recorded type.
+// The message type must be linked into the binary (registered in
+// protoregistry.GlobalTypes).
+func (ProtobufSerializer) DecodeMessage(data Payload) (proto.Message, error) {
+	wrapped := new(anypb.Any)
+	if err := proto.Unmarshal(data, wrapped); err != nil {
+		return nil, err
+	}
+	return wrapped.UnmarshalNew()
+}
+
+// MessageName returns the fully qualified name of the encoded message.
+func (ProtobufSerializer) MessageName(data Payload) (string, error) {
+	wrapped := new(anypb.Any)
+	if err := proto.Unmarshal(data, wrapped); err != nil {
+		return "", err
+	}
+	return string(wrapped.MessageName()), nil
+}
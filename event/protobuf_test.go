@@ -0,0 +1,47 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtobufSerializer(t *testing.T) {
+	evt, err := NewWithSerializer("created", wrapperspb.String("Created"), SerializerTypeProtobuf)
+	assert.NoError(t, err, "failed to create event")
+	assert.Equal(t, SerializerTypeProtobuf, evt.GetSerializer())
+
+	s := ProtobufSerializer{}
+	name, err := s.MessageName(evt.GetPayload())
+	assert.NoError(t, err, "failed to get message name")
+	assert.Equal(t, "google.protobuf.StringValue", name)
+
+	var dst wrapperspb.StringValue
+	err = s.Decode(evt.GetPayload(), &dst)
+	assert.NoError(t, err, "failed to decode")
+	assert.Equal(t, "Created", dst.GetValue())
+
+	msg, err := s.DecodeMessage(evt.GetPayload())
+	assert.NoError(t, err, "failed to decode message")
+	assert.True(t, proto.Equal(wrapperspb.String("Created"), msg))
+
+	// Mismatched message type
+	err = s.Decode(evt.GetPayload(), &wrapperspb.Int64Value{})
+	assert.Error(t, err)
+}
+
+func TestProtobufSerializerInvalidDecodeTarget(t *testing.T) {
+	s := ProtobufSerializer{}
+	payload, err := s.Encode(wrapperspb.String("test"))
+	assert.NoError(t, err)
+
+	err = s.Decode(payload, (*wrapperspb.StringValue)(nil))
+	assert.Equal(t, ErrInvalidDecodeTarget, err)
+}
+
+func TestProtobufSerializerNotMessage(t *testing.T) {
+	_, err := NewWithSerializer("created", struct{}{}, SerializerTypeProtobuf)
+	assert.Equal(t, ErrNotProtoMessage, err)
+}
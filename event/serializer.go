@@ -3,7 +3,11 @@ package event
 import (
 	"encoding/json"
 	"errors"
+	"reflect"
+	"sync"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -15,14 +19,87 @@ type Serializer interface {
 type SerializerType string
 
 const (
-	SerializerTypeJSON SerializerType = "json"
-	SerializerTypeBSON SerializerType = "bson"
+	SerializerTypeJSON     SerializerType = "json"
+	SerializerTypeBSON     SerializerType = "bson"
+	SerializerTypeProtobuf SerializerType = "protobuf"
+	SerializerTypeMsgpack  SerializerType = "msgpack"
+	SerializerTypeCBOR     SerializerType = "cbor"
 )
 
-// MatchedSerializers represents all currently available serializers.
-var MatchedSerializers = map[SerializerType]Serializer{
-	SerializerTypeJSON: &JSONSerializer{},
-	SerializerTypeBSON: &BSONSerializer{},
+var (
+	ErrUnsupportedSerializer = errors.New("unsupported serializer")
+	ErrSerializerRegistered  = errors.New("serializer is already registered")
+	ErrInvalidDecodeTarget   = errors.New("decode destination must be a non-nil pointer")
+)
+
+var (
+	serializersMu sync.RWMutex
+	// serializers represents all currently available serializers.
+	serializers = builtinSerializers()
+
+	// MatchedSerializers holds the built-in serializers, serializers
+	// registered with RegisterSerializer are not added to it. Serializers
+	// added to it are still found by LookupSerializer unless the type is
+	// registered, they must be added before events are encoded or decoded.
+	//
+	// Deprecated: Use LookupSerializer and RegisterSerializer.
+	MatchedSerializers = builtinSerializers()
+)
+
+func builtinSerializers() map[SerializerType]Serializer {
+	return map[SerializerType]Serializer{
+		SerializerTypeJSON:     &JSONSerializer{},
+		SerializerTypeBSON:     &BSONSerializer{},
+		SerializerTypeProtobuf: &ProtobufSerializer{},
+		SerializerTypeMsgpack:  &MsgpackSerializer{},
+		SerializerTypeCBOR:     &CBORSerializer{},
+	}
+}
+
+// RegisterSerializer makes serializer available by its type. It is safe
+// to call RegisterSerializer concurrently. Registering the same type twice
+// returns ErrSerializerRegistered.
+func RegisterSerializer(typ SerializerType, s Serializer) error {
+	serializersMu.Lock()
+	defer serializersMu.Unlock()
+
+	if _, ok := serializers[typ]; ok {
+		return ErrSerializerRegistered
+	}
+	serializers[typ] = s
+	return nil
+}
+
+// LookupSerializer returns serializer registered for the type, types
+// missing in the registry are looked up in MatchedSerializers.
+func LookupSerializer(typ SerializerType) (Serializer, bool) {
+	serializersMu.RLock()
+	s, ok := serializers[typ]
+	serializersMu.RUnlock()
+	if ok {
+		return s, true
+	}
+
+	s, ok = MatchedSerializers[typ]
+	return s, ok
+}
+
+// Decode decodes event payload into dst with serializer the event
+// was encoded with.
+func Decode(evt Eventer, dst interface{}) error {
+	s, ok := LookupSerializer(evt.GetSerializer())
+	if !ok {
+		return ErrUnsupportedSerializer
+	}
+	return s.Decode(evt.GetPayload(), dst)
+}
+
+func checkDecodeTarget(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrInvalidDecodeTarget
+	}
+	return nil
 }
 
 type JSONSerializer struct{}
@@ -32,7 +109,10 @@ func (JSONSerializer) Encode(v interface{}) (Payload, error) {
 }
 
 func (JSONSerializer) Decode(data Payload, dst interface{}) error {
-	return json.Unmarshal(data, &dst)
+	if err := checkDecodeTarget(dst); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
 }
 
 type BSONSerializer struct{}
@@ -42,15 +122,44 @@ func (BSONSerializer) Encode(v interface{}) (Payload, error) {
 }
 
 func (BSONSerializer) Decode(data Payload, dst interface{}) error {
-	return bson.Unmarshal(data, &dst)
+	if err := checkDecodeTarget(dst); err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, dst)
+}
+
+type MsgpackSerializer struct{}
+
+func (MsgpackSerializer) Encode(v interface{}) (Payload, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackSerializer) Decode(data Payload, dst interface{}) error {
+	if err := checkDecodeTarget(dst); err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(data, dst)
+}
+
+type CBORSerializer struct{}
+
+func (CBORSerializer) Encode(v interface{}) (Payload, error) {
+	return cbor.Marshal(v)
+}
+
+func (CBORSerializer) Decode(data Payload, dst interface{}) error {
+	if err := checkDecodeTarget(dst); err != nil {
+		return err
+	}
+	return cbor.Unmarshal(data, dst)
 }
 
 type UnsupportedSerializer struct{}
 
 func (UnsupportedSerializer) Encode(v interface{}) (Payload, error) {
-	return nil, errors.New("unsupported serializer")
+	return nil, ErrUnsupportedSerializer
 }
 
 func (UnsupportedSerializer) Decode(data Payload, dst interface{}) error {
-	return errors.New("unsupported serializer")
+	return ErrUnsupportedSerializer
 }
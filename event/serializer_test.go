@@ -0,0 +1,156 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type serializerTestPayload struct {
+	PaymentID     string
+	PaymentStatus string
+	PaymentAmount int
+	Tags          []string
+}
+
+var serializerTestTypes = []SerializerType{
+	SerializerTypeJSON,
+	SerializerTypeBSON,
+	SerializerTypeMsgpack,
+	SerializerTypeCBOR,
+}
+
+func newSerializerTestPayload() serializerTestPayload {
+	return serializerTestPayload{
+		PaymentID:     "id_0",
+		PaymentStatus: "created",
+		PaymentAmount: 100,
+		Tags:          []string{"card", "eur"},
+	}
+}
+
+func TestSerializersRoundTrip(t *testing.T) {
+	payload := newSerializerTestPayload()
+	for _, typ := range serializerTestTypes {
+		t.Run(string(typ), func(t *testing.T) {
+			evt, err := NewWithSerializer("created", payload, typ)
+			assert.NoError(t, err, "failed to create event")
+			assert.Equal(t, typ, evt.GetSerializer())
+
+			var dst serializerTestPayload
+			err = Decode(evt, &dst)
+			assert.NoError(t, err, "failed to decode")
+			assert.Equal(t, payload, dst)
+		})
+	}
+}
+
+func BenchmarkSerializersEncode(b *testing.B) {
+	payload := newSerializerTestPayload()
+	for _, typ := range serializerTestTypes {
+		s, _ := LookupSerializer(typ)
+		b.Run(string(typ), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Encode(payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSerializersDecode(b *testing.B) {
+	payload := newSerializerTestPayload()
+	for _, typ := range serializerTestTypes {
+		s, _ := LookupSerializer(typ)
+		data, err := s.Encode(payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("%s/%dB", typ, len(data)), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var dst serializerTestPayload
+				if err := s.Decode(data, &dst); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSerializersInvalidDecodeTarget(t *testing.T) {
+	for _, typ := range append(serializerTestTypes, SerializerTypeProtobuf) {
+		t.Run(string(typ), func(t *testing.T) {
+			s, ok := LookupSerializer(typ)
+			assert.True(t, ok, "serializer is not registered")
+
+			var dst serializerTestPayload
+			assert.Error(t, s.Decode(Payload{}, dst), "non-pointer destination")
+			assert.Error(t, s.Decode(Payload{}, nil), "nil destination")
+			assert.Error(t, s.Decode(Payload{}, (*serializerTestPayload)(nil)), "nil pointer destination")
+		})
+	}
+}
+
+func TestRegisterSerializer(t *testing.T) {
+	typ := SerializerType("test_register")
+	err := RegisterSerializer(typ, JSONSerializer{})
+	assert.NoError(t, err, "failed to register serializer")
+
+	err = RegisterSerializer(typ, BSONSerializer{})
+	assert.Equal(t, ErrSerializerRegistered, err)
+
+	s, ok := LookupSerializer(typ)
+	assert.True(t, ok)
+	assert.Equal(t, JSONSerializer{}, s)
+	_, ok = MatchedSerializers[typ]
+	assert.False(t, ok, "registered serializers must not be added to MatchedSerializers")
+	assert.NotNil(t, MatchedSerializers[SerializerTypeJSON])
+}
+
+func TestMatchedSerializers(t *testing.T) {
+	typ := SerializerType("test_matched")
+	MatchedSerializers[typ] = JSONSerializer{}
+	defer delete(MatchedSerializers, typ)
+
+	s, ok := LookupSerializer(typ)
+	assert.True(t, ok, "serializers of MatchedSerializers must be found")
+	assert.Equal(t, JSONSerializer{}, s)
+
+	evt, err := NewWithSerializer("created", serializerTestPayload{}, typ)
+	assert.NoError(t, err, "failed to encode with serializer of MatchedSerializers")
+	assert.Equal(t, typ, evt.GetSerializer())
+
+	// Registered serializers take precedence
+	MatchedSerializers[SerializerTypeJSON] = BSONSerializer{}
+	defer func() { MatchedSerializers[SerializerTypeJSON] = &JSONSerializer{} }()
+	s, ok = LookupSerializer(SerializerTypeJSON)
+	assert.True(t, ok)
+	assert.Equal(t, &JSONSerializer{}, s)
+}
+
+func TestRegisterSerializerConcurrent(t *testing.T) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errors int
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := RegisterSerializer("test_concurrent", JSONSerializer{}); err != nil {
+				mu.Lock()
+				errors++
+				mu.Unlock()
+			}
+			LookupSerializer("test_concurrent")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 15, errors, "serializer must be registered only once")
+}
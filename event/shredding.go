@@ -0,0 +1,138 @@
+package event
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrDataShredded is returned when data of a forgotten subject is decrypted.
+var ErrDataShredded = errors.New("data is shredded, subject key was deleted")
+
+// SubjectKeyStore stores data keys per subject (aggregate, customer, etc.).
+// Deleting the key of a subject makes all data encrypted with it
+// unreadable (crypto-shredding), while events themselves stay immutable.
+type SubjectKeyStore interface {
+	// CreateKey returns the key of the subject, creating it on first use.
+	// Returns ErrDataShredded if the key was deleted.
+	CreateKey(ctx context.Context, subject string) ([]byte, error)
+	// Key returns the key of the subject. Returns ErrDataShredded if the key
+	// was deleted or never existed.
+	Key(ctx context.Context, subject string) ([]byte, error)
+	// Delete deletes the key of the subject, it is never created again.
+	Delete(ctx context.Context, subject string) error
+}
+
+// Sealed represents encrypted value of a payload field. Payload structs use
+// Sealed for fields that must be forgotten, e.g. customer email.
+type Sealed []byte
+
+// Shredder encrypts selected payload fields with per-subject data keys.
+type Shredder struct {
+	keys SubjectKeyStore
+}
+
+func NewShredder(keys SubjectKeyStore) *Shredder {
+	return &Shredder{keys: keys}
+}
+
+// Seal encodes v in JSON and encrypts it with the subject key.
+func (s *Shredder) Seal(ctx context.Context, subject string, v interface{}) (Sealed, error) {
+	key, err := s.keys.CreateKey(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := JSONSerializer{}.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return seal(key, data, []byte(subject))
+}
+
+// Open decrypts sealed value into dst. If the subject was forgotten
+// ErrDataShredded is returned and dst is left untouched.
+func (s *Shredder) Open(ctx context.Context, subject string, sealed Sealed, dst interface{}) error {
+	if len(sealed) == 0 {
+		return nil
+	}
+
+	key, err := s.keys.Key(ctx, subject)
+	if err != nil {
+		return err
+	}
+
+	data, err := open(key, sealed, []byte(subject))
+	if err != nil {
+		return err
+	}
+	return JSONSerializer{}.Decode(data, dst)
+}
+
+// Forget deletes the subject key, so all its sealed values become unreadable.
+func (s *Shredder) Forget(ctx context.Context, subject string) error {
+	return s.keys.Delete(ctx, subject)
+}
+
+// IgnoreShredded returns nil if err is caused by shredded data. Transitions
+// and projections use it to skip forgotten fields instead of failing.
+func IgnoreShredded(err error) error {
+	if errors.Is(err, ErrDataShredded) {
+		return nil
+	}
+	return err
+}
+
+// MemorySubjectKeyStore is an in-process SubjectKeyStore.
+type MemorySubjectKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+var _ (SubjectKeyStore) = &MemorySubjectKeyStore{}
+
+func NewMemorySubjectKeyStore() *MemorySubjectKeyStore {
+	return &MemorySubjectKeyStore{keys: make(map[string][]byte)}
+}
+
+func (s *MemorySubjectKeyStore) CreateKey(ctx context.Context, subject string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[subject]
+	if ok && key == nil {
+		return nil, ErrDataShredded
+	}
+	if ok {
+		return key, nil
+	}
+
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	s.keys[subject] = key
+	return key, nil
+}
+
+func (s *MemorySubjectKeyStore) Key(ctx context.Context, subject string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.keys[subject]
+	if key == nil {
+		return nil, ErrDataShredded
+	}
+	return key, nil
+}
+
+func (s *MemorySubjectKeyStore) Delete(ctx context.Context, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep deleted subject, so its key is never created again
+	s.keys[subject] = nil
+	return nil
+}
@@ -0,0 +1,44 @@
+package event
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type customerRegisteredEvent struct {
+	CustomerID string
+	Email      Sealed
+}
+
+func TestShredder(t *testing.T) {
+	ctx := context.TODO()
+	shredder := NewShredder(NewMemorySubjectKeyStore())
+
+	email, err := shredder.Seal(ctx, "customer_0", "john@example.com")
+	assert.NoError(t, err, "failed to seal")
+
+	evt, err := New("registered", customerRegisteredEvent{CustomerID: "customer_0", Email: email})
+	assert.NoError(t, err, "failed to create event")
+	assert.NotContains(t, string(evt.GetPayload()), "john@example.com")
+
+	var payload customerRegisteredEvent
+	assert.NoError(t, Decode(evt, &payload), "failed to decode")
+
+	var got string
+	assert.NoError(t, shredder.Open(ctx, "customer_0", payload.Email, &got), "failed to open")
+	assert.Equal(t, "john@example.com", got)
+
+	assert.NoError(t, shredder.Forget(ctx, "customer_0"), "failed to forget")
+
+	got = ""
+	err = shredder.Open(ctx, "customer_0", payload.Email, &got)
+	assert.Equal(t, ErrDataShredded, err)
+	assert.NoError(t, IgnoreShredded(err))
+	assert.Equal(t, "", got)
+
+	// Forgotten subject key is never created again
+	_, err = shredder.Seal(ctx, "customer_0", "john@example.com")
+	assert.Equal(t, ErrDataShredded, err)
+}
@@ -0,0 +1,98 @@
+package event
+
+import (
+	"crypto/ed25519"
+	"errors"
+)
+
+// Signature represents a signature of the canonical event encoding and id
+// of the key it was produced with.
+type Signature struct {
+	KeyId string
+	Value []byte
+}
+
+// Signer signs events on append. KeyId identifies the producer service.
+type Signer interface {
+	KeyId() string
+	Sign(message []byte) ([]byte, error)
+}
+
+// SignatureVerifier verifies signatures by key id.
+type SignatureVerifier interface {
+	Verify(keyId string, message, signature []byte) error
+}
+
+var (
+	ErrSignatureMissing  = errors.New("event is not signed")
+	ErrSignatureInvalid  = errors.New("event signature is invalid")
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+)
+
+// Sign signs canonical encoding of the event and sets its signature. Events
+// are signed with timestamps as they are stored, stores truncate timestamps
+// to microseconds before signing.
+func Sign(evt Eventer, signer Signer) error {
+	value, err := signer.Sign(Canonical(evt))
+	if err != nil {
+		return err
+	}
+	evt.SetSignature(Signature{KeyId: signer.KeyId(), Value: value})
+	return nil
+}
+
+// VerifySignature verifies the event signature. If strict is true unsigned
+// events are rejected with ErrSignatureMissing, otherwise only signed events
+// are verified.
+func VerifySignature(evt Eventer, verifier SignatureVerifier, strict bool) error {
+	signature := evt.GetSignature()
+	if len(signature.Value) == 0 {
+		if strict {
+			return ErrSignatureMissing
+		}
+		return nil
+	}
+	return verifier.Verify(signature.KeyId, Canonical(evt), signature.Value)
+}
+
+// Ed25519Signer signs events with Ed25519 private key.
+type Ed25519Signer struct {
+	keyId string
+	key   ed25519.PrivateKey
+}
+
+var _ (Signer) = &Ed25519Signer{}
+
+func NewEd25519Signer(keyId string, key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{keyId: keyId, key: key}
+}
+
+func (s *Ed25519Signer) KeyId() string {
+	return s.keyId
+}
+
+func (s *Ed25519Signer) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, message), nil
+}
+
+// Ed25519Verifier verifies Ed25519 signatures with known public keys.
+type Ed25519Verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+var _ (SignatureVerifier) = &Ed25519Verifier{}
+
+func NewEd25519Verifier(keys map[string]ed25519.PublicKey) *Ed25519Verifier {
+	return &Ed25519Verifier{keys: keys}
+}
+
+func (v *Ed25519Verifier) Verify(keyId string, message, signature []byte) error {
+	key, ok := v.keys[keyId]
+	if !ok {
+		return ErrUnknownSigningKey
+	}
+	if !ed25519.Verify(key, message, signature) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
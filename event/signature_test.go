@@ -0,0 +1,34 @@
+package event
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "failed to generate key")
+
+	signer := NewEd25519Signer("payments", priv)
+	verifier := NewEd25519Verifier(map[string]ed25519.PublicKey{"payments": pub})
+
+	evt := MustNew("created", struct{ Status string }{Status: "Created"})
+	evt.SetAggregateId("agg_0")
+	evt.SetMetadata(Metadata{"correlation_id": "request_0"})
+
+	assert.Equal(t, ErrSignatureMissing, VerifySignature(evt, verifier, true))
+	assert.NoError(t, VerifySignature(evt, verifier, false), "unsigned event is allowed in non-strict mode")
+
+	assert.NoError(t, Sign(evt, signer), "failed to sign")
+	assert.Equal(t, "payments", evt.GetSignature().KeyId)
+	assert.NoError(t, VerifySignature(evt, verifier, true))
+
+	evt.GetMetadata()["correlation_id"] = "request_1"
+	assert.Equal(t, ErrSignatureInvalid, VerifySignature(evt, verifier, false))
+
+	evt.SetSignature(Signature{KeyId: "ledger", Value: evt.GetSignature().Value})
+	assert.Equal(t, ErrUnknownSigningKey, VerifySignature(evt, verifier, false))
+}
@@ -0,0 +1,24 @@
+package event
+
+import "time"
+
+// ReasonTombstone is the reason of the event which closes the stream. No
+// events can be appended to the stream after the tombstone.
+const ReasonTombstone = "$tombstone"
+
+// NewTombstone creates tombstone event of the aggregate stream.
+func NewTombstone(aggregateId, aggregateType string, version Version) *Event {
+	return &Event{
+		aggregateId:    aggregateId,
+		aggregateType:  aggregateType,
+		reason:         ReasonTombstone,
+		version:        version,
+		tstamp:         Timestamp(time.Now()),
+		serializerType: SerializerTypeJSON,
+	}
+}
+
+// IsTombstone reports whether the event closes the stream.
+func IsTombstone(evt Eventer) bool {
+	return evt.GetReason() == ReasonTombstone
+}
@@ -1,32 +1,88 @@
 package eventsourcing
 
 import (
+	"context"
 	"errors"
+	"log/slog"
 	"reflect"
 
 	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/internal/logging"
 )
 
 type AggregateCluster struct {
-	currentId      string
-	currentType    string
-	currentVersion event.Version
+	currentTenantId string
+	currentId       string
+	currentType     string
+	currentVersion  event.Version
 	// internal.
 	committedEvents   []event.Eventer
 	uncommittedEvents *linkedList
 	transitionfn      event.Transition
+	applyHooks        []ApplyHook
+	interceptors      []TransitionInterceptor
+	logger            *slog.Logger
+}
+
+// ApplyHook is called after every event applied into aggregate, committed
+// reports whether the event was applied with ApplyCommitted.
+type ApplyHook func(evt event.Eventer, committed bool)
+
+// Option configures AggregateCluster.
+type Option func(r *AggregateCluster)
+
+// WithApplyHook adds hook called after every applied event, e.g. to collect
+// metrics.
+func WithApplyHook(hook ApplyHook) Option {
+	return func(r *AggregateCluster) {
+		r.applyHooks = append(r.applyHooks, hook)
+	}
+}
+
+// TransitionInterceptor is called around every Transition call, it calls
+// transition to proceed. Context is the one passed to ApplyContext or
+// ApplyCommittedContext.
+type TransitionInterceptor func(ctx context.Context, evt event.Eventer, committed bool, transition func() error) error
+
+// WithTransitionInterceptor adds interceptor of Transition calls, e.g. to
+// trace them. The first interceptor is the outermost.
+func WithTransitionInterceptor(interceptor TransitionInterceptor) Option {
+	return func(r *AggregateCluster) {
+		r.interceptors = append(r.interceptors, interceptor)
+	}
+}
+
+// WithLogger sets logger of applied and rejected events, nothing is logged by
+// default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *AggregateCluster) {
+		r.logger = logger
+	}
 }
 
 var _ (event.Aggregator) = &AggregateCluster{}
 
-func New(agg event.Aggregator, transition event.Transition, idgenfn IDGenerator) *AggregateCluster {
-	return &AggregateCluster{
+func New(agg event.Aggregator, transition event.Transition, idgenfn IDGenerator, opts ...Option) *AggregateCluster {
+	r := &AggregateCluster{
 		currentId:         idgenfn(idDefaultAlphabet, idDefaultSize),
 		currentType:       reflect.TypeOf(agg).Elem().Name(),
 		committedEvents:   make([]event.Eventer, 0, 8),
 		uncommittedEvents: new(linkedList),
 		transitionfn:      transition,
+		logger:            logging.Discard(),
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
+}
+
+func (r *AggregateCluster) GetTenantId() string {
+	return r.currentTenantId
+}
+
+func (r *AggregateCluster) SetTenantId(id string) {
+	r.currentTenantId = id
 }
 
 func (r *AggregateCluster) GetId() string {
@@ -53,42 +109,116 @@ func (r *AggregateCluster) SetVersion(version event.Version) {
 	r.currentVersion = version
 }
 
-// Apply applies not committed yet event. The event Id, Type, Version will
-// be replaced with current AggregateCluster Id, Type and Version.
+// Apply applies not committed yet event. The event TenantId, Id, Type, Version
+// will be replaced with current AggregateCluster TenantId, Id, Type and Version.
 func (r *AggregateCluster) Apply(evt event.Eventer) error {
-	return r.apply(evt, false)
+	return r.apply(context.Background(), evt, false)
+}
+
+// ApplyContext is Apply with context passed to transition interceptors.
+func (r *AggregateCluster) ApplyContext(ctx context.Context, evt event.Eventer) error {
+	return r.apply(ctx, evt, false)
 }
 
 // ApplyCommitted applies already committed event. The AggregateCluster state
-// id, type, version will be replaced with current event id, type and version.
+// tenant id, id, type, version will be replaced with current event tenant id,
+// id, type and version.
 func (r *AggregateCluster) ApplyCommitted(evt event.Eventer) error {
-	return r.apply(evt, true)
+	return r.apply(context.Background(), evt, true)
 }
 
-func (r *AggregateCluster) apply(evt event.Eventer, committed bool) error {
-	if err := r.transitionfn(evt); err != nil {
+// ApplyCommittedContext is ApplyCommitted with context passed to transition
+// interceptors.
+func (r *AggregateCluster) ApplyCommittedContext(ctx context.Context, evt event.Eventer) error {
+	return r.apply(ctx, evt, true)
+}
+
+func (r *AggregateCluster) apply(ctx context.Context, evt event.Eventer, committed bool) error {
+	if err := r.applyEvent(ctx, evt, committed); err != nil {
+		r.log(ctx, slog.LevelWarn, "event rejected", evt, committed, slog.Any("error", err))
 		return err
 	}
+	r.log(ctx, slog.LevelDebug, "event applied", evt, committed)
+	for _, hook := range r.applyHooks {
+		hook(evt, committed)
+	}
+	return nil
+}
 
-	if committed {
-		if err := r.checkVersionDuplication(evt); err != nil {
+func (r *AggregateCluster) log(ctx context.Context, level slog.Level, msg string, evt event.Eventer, committed bool, attrs ...slog.Attr) {
+	if !r.logger.Enabled(ctx, level) {
+		return
+	}
+	// Rejected uncommitted event has no aggregate and version yet
+	id, typ, version := evt.GetAggregateId(), evt.GetAggregateType(), evt.GetVersion()
+	if id == "" {
+		id, typ, version = r.currentId, r.currentType, r.nextVersion()
+	}
+	r.logger.LogAttrs(ctx, level, msg, append([]slog.Attr{
+		slog.String("aggregate_id", id),
+		slog.String("aggregate_type", typ),
+		slog.Int("version", int(version)),
+		slog.String("reason", evt.GetReason()),
+		slog.Bool("committed", committed),
+	}, attrs...)...)
+}
+
+func (r *AggregateCluster) applyEvent(ctx context.Context, evt event.Eventer, committed bool) error {
+	// Tombstone only closes the stream, it never changes aggregate state
+	if event.IsTombstone(evt) {
+		if !committed {
+			return ErrTombstoneApplied
+		}
+		return r.applyCommitted(evt)
+	}
+
+	if err := r.transition(ctx, evt, committed); err != nil {
+		// Already committed events with shredded data are still applied,
+		// so aggregates of forgotten subjects can be loaded.
+		if !committed || !errors.Is(err, event.ErrDataShredded) {
 			return err
 		}
+	}
+
+	if committed {
+		return r.applyCommitted(evt)
+	}
+
+	// Increment our aggregate root version for +1
+	r.currentVersion = r.nextVersion()
 
-		r.currentId = evt.GetAggregateId()
-		r.currentType = evt.GetAggregateType()
-		r.currentVersion = evt.GetVersion()
-		r.committedEvents = append(r.committedEvents, evt)
-	} else {
-		// Increment our aggregate root version for +1
-		r.currentVersion = r.nextVersion()
+	evt.SetTenantId(r.currentTenantId)
+	evt.SetAggregateId(r.currentId)
+	evt.SetAggregateType(r.currentType)
+	evt.SetVersion(r.currentVersion)
+	r.uncommittedEvents.add(evt)
 
-		evt.SetAggregateId(r.currentId)
-		evt.SetAggregateType(r.currentType)
-		evt.SetVersion(r.currentVersion)
-		r.uncommittedEvents.add(evt)
+	return nil
+}
+
+func (r *AggregateCluster) transition(ctx context.Context, evt event.Eventer, committed bool) error {
+	transition := func() error {
+		return r.transitionfn(evt)
+	}
+	for i := len(r.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := r.interceptors[i], transition
+		transition = func() error {
+			return interceptor(ctx, evt, committed, next)
+		}
+	}
+	return transition()
+}
+
+func (r *AggregateCluster) applyCommitted(evt event.Eventer) error {
+	if err := r.checkVersionDuplication(evt); err != nil {
+		return err
 	}
 
+	r.currentTenantId = evt.GetTenantId()
+	r.currentId = evt.GetAggregateId()
+	r.currentType = evt.GetAggregateType()
+	r.currentVersion = evt.GetVersion()
+	r.committedEvents = append(r.committedEvents, evt)
 	return nil
 }
 
@@ -97,6 +227,13 @@ func (r *AggregateCluster) ListCommittedEvents() []event.Eventer {
 	return r.committedEvents
 }
 
+// DropCommittedEvents releases committed events kept by the aggregate, e.g.
+// before it's cached for long. State and version of the aggregate are kept,
+// ListCommittedEvents returns only events committed after the drop.
+func (r *AggregateCluster) DropCommittedEvents() {
+	r.committedEvents = nil
+}
+
 // ListUncommittedEvents returns a list of not committed yet events.
 func (r *AggregateCluster) ListUncommittedEvents() []event.Eventer {
 	uncommittedEvents := make([]event.Eventer, 0, r.uncommittedEvents.len)
@@ -117,7 +254,10 @@ func (r *AggregateCluster) nextVersion() event.Version {
 	return r.currentVersion + event.NextVersion
 }
 
-var ErrEventDuplication = errors.New("event duplication, event is already exist")
+var (
+	ErrEventDuplication = errors.New("event duplication, event is already exist")
+	ErrTombstoneApplied = errors.New("tombstone can not be applied, use stream deletion of event store")
+)
 
 func (r *AggregateCluster) checkVersionDuplication(evt event.Eventer) error {
 	for i := range r.committedEvents {
@@ -1,8 +1,11 @@
 package eventsourcing
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"testing"
 
 	"github.com/0x9ef/eventsourcing-go/event"
@@ -227,3 +230,139 @@ func TestCommit(t *testing.T) {
 
 	assert.Equal(t, 0, agg.uncommittedEvents.len)
 }
+
+func TestApplyCommittedShredded(t *testing.T) {
+	agg := &PaymentAggregator{}
+	agg.AggregateCluster = New(agg, func(evt event.Eventer) error {
+		if evt.GetReason() == PaymentAggregateReasonCreated {
+			return event.ErrDataShredded
+		}
+		return agg.Transition(evt)
+	}, NanoidGenerator)
+
+	evtCreated := mustNewEvent(PaymentAggregateReasonCreated, paymentCreatedEvent{})
+	evtCreated.SetAggregateId("agg_0")
+	evtCreated.SetAggregateType("PaymentAggregator")
+	evtCreated.SetVersion(1)
+
+	evtConfirmed := mustNewEvent(PaymentAggregateReasonConfirmed, paymentConfirmedEvent{
+		PaymentStatus: "confirmed",
+	})
+	evtConfirmed.SetAggregateId("agg_0")
+	evtConfirmed.SetAggregateType("PaymentAggregator")
+	evtConfirmed.SetVersion(2)
+
+	for _, evt := range []*event.Event{evtCreated, evtConfirmed} {
+		err := agg.ApplyCommitted(evt)
+		assert.NoError(t, err, "shredded committed event must be applied")
+	}
+	assert.Equal(t, "confirmed", agg.PaymentStatus)
+	assert.Equal(t, event.Version(2), agg.GetVersion())
+
+	// Not committed events with shredded data are rejected
+	err := agg.Apply(mustNewEvent(PaymentAggregateReasonCreated, paymentCreatedEvent{}))
+	assert.Equal(t, event.ErrDataShredded, err)
+}
+
+func TestApplyTenant(t *testing.T) {
+	agg := &PaymentAggregator{}
+	agg.AggregateCluster = New(agg, agg.Transition, NanoidGenerator)
+	agg.SetTenantId("tenant_a")
+
+	evt := mustNewEvent(PaymentAggregateReasonCreated, paymentCreatedEvent{PaymentID: "id_0"})
+	err := agg.Apply(evt)
+	assert.NoError(t, err, "failed to apply event")
+	assert.Equal(t, "tenant_a", evt.GetTenantId())
+
+	loaded := &PaymentAggregator{}
+	loaded.AggregateCluster = New(loaded, loaded.Transition, NanoidGenerator)
+	err = loaded.ApplyCommitted(evt)
+	assert.NoError(t, err, "failed to apply committed")
+	assert.Equal(t, "tenant_a", loaded.GetTenantId())
+}
+
+func TestApplyTombstone(t *testing.T) {
+	agg := &PaymentAggregator{}
+	agg.AggregateCluster = New(agg, agg.Transition, NanoidGenerator)
+
+	evtCreated := mustNewEvent(PaymentAggregateReasonCreated, paymentCreatedEvent{PaymentID: "id_0"})
+	evtCreated.SetAggregateId("agg_0")
+	evtCreated.SetAggregateType("PaymentAggregator")
+	evtCreated.SetVersion(1)
+
+	for _, evt := range []event.Eventer{evtCreated, event.NewTombstone("agg_0", "PaymentAggregator", 2)} {
+		err := agg.ApplyCommitted(evt)
+		assert.NoError(t, err, "failed to apply committed")
+	}
+	assert.Equal(t, "id_0", agg.PaymentID)
+	assert.Equal(t, event.Version(2), agg.GetVersion())
+
+	err := agg.Apply(event.NewTombstone("agg_0", "PaymentAggregator", 3))
+	assert.Equal(t, ErrTombstoneApplied, err)
+}
+
+func TestApplyHook(t *testing.T) {
+	var applied []string
+	hook := func(evt event.Eventer, committed bool) {
+		if committed {
+			applied = append(applied, "committed:"+evt.GetReason())
+			return
+		}
+		applied = append(applied, evt.GetReason())
+	}
+
+	agg := &PaymentAggregator{}
+	agg.AggregateCluster = New(agg, agg.Transition, NanoidGenerator, WithApplyHook(hook))
+
+	evt := mustNewEvent(PaymentAggregateReasonCreated, paymentCreatedEvent{PaymentID: "id_0"})
+	assert.NoError(t, agg.Apply(evt), "failed to apply event")
+	err := agg.Apply(mustNewEvent("unknown", paymentCreatedEvent{}))
+	assert.Error(t, err, "unknown event must not be applied")
+
+	loaded := &PaymentAggregator{}
+	loaded.AggregateCluster = New(loaded, loaded.Transition, NanoidGenerator, WithApplyHook(hook))
+	assert.NoError(t, loaded.ApplyCommitted(evt), "failed to apply committed")
+
+	assert.Equal(t, []string{"created", "committed:created"}, applied)
+}
+
+func TestTransitionInterceptor(t *testing.T) {
+	type ctxKey struct{}
+
+	var calls []string
+	interceptor := func(name string) TransitionInterceptor {
+		return func(ctx context.Context, evt event.Eventer, committed bool, transition func() error) error {
+			calls = append(calls, name+":"+ctx.Value(ctxKey{}).(string))
+			return transition()
+		}
+	}
+
+	agg := &PaymentAggregator{}
+	agg.AggregateCluster = New(agg, agg.Transition, NanoidGenerator,
+		WithTransitionInterceptor(interceptor("outer")),
+		WithTransitionInterceptor(interceptor("inner")),
+	)
+
+	ctx := context.WithValue(context.TODO(), ctxKey{}, "cmd")
+	evt := mustNewEvent(PaymentAggregateReasonCreated, paymentCreatedEvent{PaymentID: "id_0"})
+	assert.NoError(t, agg.ApplyContext(ctx, evt), "failed to apply event")
+	assert.Equal(t, "id_0", agg.PaymentID)
+	assert.Equal(t, []string{"outer:cmd", "inner:cmd"}, calls)
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	agg := &PaymentAggregator{}
+	agg.AggregateCluster = New(agg, agg.Transition, NanoidGenerator, WithLogger(logger))
+	agg.SetId("pay_0")
+
+	evt := mustNewEvent(PaymentAggregateReasonCreated, paymentCreatedEvent{PaymentID: "id_0"})
+	assert.NoError(t, agg.Apply(evt), "failed to apply event")
+	assert.Contains(t, buf.String(), `level=DEBUG msg="event applied" aggregate_id=pay_0 aggregate_type=PaymentAggregator version=1 reason=created`)
+
+	err := agg.Apply(mustNewEvent("unknown", paymentCreatedEvent{}))
+	assert.Error(t, err, "unknown event must not be applied")
+	assert.Contains(t, buf.String(), `level=WARN msg="event rejected" aggregate_id=pay_0 aggregate_type=PaymentAggregator version=2 reason=unknown committed=false error="undefined event type"`)
+}
@@ -0,0 +1,247 @@
+package eventstore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+// AggregateCache keeps the least recently used loaded aggregates in memory.
+// Loading of the cached aggregate fetches only events saved after its
+// version. Loaded aggregate is owned by the caller until it's saved with
+// Save or returned with Release, so concurrent loads of the same aggregate
+// never share its state. Streams deleted or archived bypassing the cache
+// must be forgotten with Forget.
+// Cached aggregates drop their committed events (see
+// eventsourcing.AggregateCluster.DropCommittedEvents), so memory of a hot
+// aggregate doesn't grow with its stream.
+type AggregateCache struct {
+	repo Repository
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	stats   CacheStats
+}
+
+// CacheStats are counters of the aggregate cache.
+type CacheStats struct {
+	// Hits is number of loads served from memory.
+	Hits uint64
+	// Misses is number of loads of whole stream.
+	Misses uint64
+	// Evictions is number of aggregates evicted by size limit, TTL, save
+	// failures, deletion or archival.
+	Evictions uint64
+}
+
+// committedDropper is implemented by aggregates which release their
+// committed events when cached.
+type committedDropper interface {
+	DropCommittedEvents()
+}
+
+type cacheKey struct {
+	tenantId      string
+	aggregateId   string
+	aggregateType string
+}
+
+type cacheEntry struct {
+	key      cacheKey
+	agg      event.Aggregator
+	cachedAt time.Time
+}
+
+// NewAggregateCache returns cache of at most size aggregates, aggregates
+// cached longer than ttl are reloaded. Zero ttl means no expiration.
+func NewAggregateCache(repo Repository, size int, ttl time.Duration) *AggregateCache {
+	return &AggregateCache{
+		repo:    repo,
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Load returns aggregate with its committed events applied. Aggregate is
+// taken from the cache and caught up with newer events, or created with
+// newfn and loaded from the whole stream. Empty stream is ErrEventNotFound.
+func (c *AggregateCache) Load(ctx context.Context, aggregateID, aggregateType string, newfn func() event.Aggregator) (event.Aggregator, error) {
+	key := cacheKey{TenantFromContext(ctx), aggregateID, aggregateType}
+
+	agg, hit := c.take(key)
+	if !hit {
+		agg = newfn()
+	}
+
+	var filter *ListFilter
+	if hit {
+		filter = &ListFilter{AfterVersion: agg.GetVersion()}
+	}
+	events, err := c.repo.List(ctx, aggregateID, aggregateType, filter)
+	if err != nil {
+		return nil, err
+	}
+	if !hit && len(events) == 0 {
+		return nil, ErrEventNotFound
+	}
+	for _, evt := range events {
+		if err := agg.ApplyCommitted(evt); err != nil {
+			return nil, err
+		}
+	}
+
+	return agg, nil
+}
+
+// Save saves uncommitted events of the aggregate and puts it into the cache.
+// Aggregate which failed to save, e.g. with ErrControlConcurrency, stays
+// out of the cache and is reloaded by the next Load.
+func (c *AggregateCache) Save(ctx context.Context, agg event.Aggregator) error {
+	events := agg.ListUncommittedEvents()
+	if err := c.repo.Save(ctx, events); err != nil {
+		if errors.Is(err, ErrControlConcurrency) {
+			c.evict(cacheKey{TenantFromContext(ctx), agg.GetId(), agg.GetType()})
+		}
+		return err
+	}
+	for _, evt := range events {
+		if err := agg.Commit(evt); err != nil {
+			return err
+		}
+	}
+
+	c.put(cacheKey{TenantFromContext(ctx), agg.GetId(), agg.GetType()}, agg)
+	return nil
+}
+
+// Release returns loaded aggregate into the cache without saving, e.g.
+// after read-only use. Aggregate with uncommitted events is dropped.
+func (c *AggregateCache) Release(ctx context.Context, agg event.Aggregator) {
+	if len(agg.ListUncommittedEvents()) != 0 {
+		return
+	}
+	c.put(cacheKey{TenantFromContext(ctx), agg.GetId(), agg.GetType()}, agg)
+}
+
+// Forget evicts aggregate from the cache, e.g. after its stream was
+// deleted or archived bypassing the cache.
+func (c *AggregateCache) Forget(ctx context.Context, aggregateID, aggregateType string) {
+	c.evict(cacheKey{TenantFromContext(ctx), aggregateID, aggregateType})
+}
+
+// SoftDelete closes the stream with tombstone and evicts its aggregate.
+// Repository must implement StreamDeleter, otherwise ErrNotSupported is
+// returned.
+func (c *AggregateCache) SoftDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	deleter, ok := c.repo.(StreamDeleter)
+	if !ok {
+		return ErrNotSupported
+	}
+	defer c.Forget(ctx, aggregateID, aggregateType)
+	return deleter.SoftDelete(ctx, aggregateID, aggregateType)
+}
+
+// HardDelete deletes all events of the stream and evicts its aggregate.
+// Repository must implement StreamDeleter, otherwise ErrNotSupported is
+// returned.
+func (c *AggregateCache) HardDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	deleter, ok := c.repo.(StreamDeleter)
+	if !ok {
+		return ErrNotSupported
+	}
+	defer c.Forget(ctx, aggregateID, aggregateType)
+	return deleter.HardDelete(ctx, aggregateID, aggregateType)
+}
+
+// Archive moves the stream into archive storage and evicts its aggregate.
+// Repository must implement Archiver, otherwise ErrNotSupported is
+// returned.
+func (c *AggregateCache) Archive(ctx context.Context, aggregateID, aggregateType string) error {
+	archiver, ok := c.repo.(Archiver)
+	if !ok {
+		return ErrNotSupported
+	}
+	defer c.Forget(ctx, aggregateID, aggregateType)
+	return archiver.Archive(ctx, aggregateID, aggregateType)
+}
+
+// Stats returns counters of the cache.
+func (c *AggregateCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Len returns number of cached aggregates.
+func (c *AggregateCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// take removes aggregate from the cache and reports whether it was cached
+// and not expired.
+func (c *AggregateCache) take(key cacheKey) (event.Aggregator, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.remove(elem)
+
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Since(entry.cachedAt) > c.ttl {
+		c.stats.Evictions++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.stats.Hits++
+	return entry.agg, true
+}
+
+func (c *AggregateCache) put(key cacheKey, agg event.Aggregator) {
+	if dropper, ok := agg.(committedDropper); ok {
+		dropper.DropCommittedEvents()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, agg: agg, cachedAt: time.Now()})
+
+	for c.size > 0 && c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *AggregateCache) evict(key cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+		c.stats.Evictions++
+	}
+}
+
+func (c *AggregateCache) remove(elem *list.Element) {
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+	c.lru.Remove(elem)
+}
@@ -0,0 +1,137 @@
+package eventstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/memory"
+)
+
+func TestAggregateCache(t *testing.T) {
+	ctx := context.TODO()
+	repo := memory.New()
+	cache := eventstore.NewAggregateCache(repo, 1, 0)
+	newfn := func() event.Aggregator { return newBalance() }
+
+	balance := newBalance()
+	assert.NoError(t, balance.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 100})))
+	assert.NoError(t, cache.Save(ctx, balance), "failed to save aggregate")
+	assert.Equal(t, 1, cache.Len())
+
+	// Events saved by other writers are fetched incrementally
+	other := newBalance()
+	other.SetId(balance.GetId())
+	other.SetVersion(balance.GetVersion())
+	assert.NoError(t, other.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 50})))
+	assert.NoError(t, repo.Save(ctx, other.ListUncommittedEvents()))
+
+	agg, err := cache.Load(ctx, balance.GetId(), balance.GetType(), newfn)
+	assert.NoError(t, err, "failed to load aggregate")
+	assert.True(t, agg == event.Aggregator(balance), "aggregate must be served from memory")
+	assert.Equal(t, 150, balance.Balance)
+	assert.Equal(t, event.Version(2), balance.GetVersion())
+	assert.Equal(t, eventstore.CacheStats{Hits: 1}, cache.Stats())
+
+	// Loaded aggregate is owned by the caller
+	loaded, err := cache.Load(ctx, balance.GetId(), balance.GetType(), newfn)
+	assert.NoError(t, err, "failed to load aggregate")
+	assert.False(t, loaded == event.Aggregator(balance), "owned aggregate must not be shared")
+	assert.Equal(t, 150, loaded.(*BalanceAggregator).Balance)
+	cache.Release(ctx, loaded)
+
+	// Conflicting save evicts aggregate
+	assert.NoError(t, loaded.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 20})))
+	assert.NoError(t, cache.Save(ctx, loaded), "failed to save aggregate")
+	assert.NoError(t, balance.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 10})))
+	err = cache.Save(ctx, balance)
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	assert.Equal(t, 0, cache.Len())
+
+	_, err = cache.Load(ctx, "unknown", balance.GetType(), newfn)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+}
+
+func TestAggregateCacheEviction(t *testing.T) {
+	ctx := context.TODO()
+	repo := memory.New()
+	cache := eventstore.NewAggregateCache(repo, 1, time.Millisecond)
+	newfn := func() event.Aggregator { return newBalance() }
+
+	first, second := newBalance(), newBalance()
+	for _, agg := range []*BalanceAggregator{first, second} {
+		assert.NoError(t, agg.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 100})))
+		assert.NoError(t, cache.Save(ctx, agg), "failed to save aggregate")
+	}
+	assert.Equal(t, 1, cache.Len())
+	assert.Equal(t, uint64(1), cache.Stats().Evictions, "least recently used aggregate must be evicted")
+
+	time.Sleep(5 * time.Millisecond)
+	agg, err := cache.Load(ctx, second.GetId(), second.GetType(), newfn)
+	assert.NoError(t, err, "failed to load aggregate")
+	assert.False(t, agg == event.Aggregator(second), "expired aggregate must be reloaded")
+	assert.Equal(t, 100, agg.(*BalanceAggregator).Balance)
+	assert.Equal(t, eventstore.CacheStats{Misses: 1, Evictions: 2}, cache.Stats())
+}
+
+func TestAggregateCacheDeletion(t *testing.T) {
+	ctx := context.TODO()
+	cache := eventstore.NewAggregateCache(memory.New(), 2, 0)
+	newfn := func() event.Aggregator { return newBalance() }
+
+	deleted := newBalance()
+	assert.NoError(t, deleted.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 100})))
+	assert.NoError(t, cache.Save(ctx, deleted), "failed to save aggregate")
+	archived := newBalance()
+	assert.NoError(t, archived.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 50})))
+	assert.NoError(t, cache.Save(ctx, archived), "failed to save aggregate")
+	assert.Equal(t, 2, cache.Len())
+
+	// Deleted stream is not served from memory
+	assert.NoError(t, cache.HardDelete(ctx, deleted.GetId(), deleted.GetType()))
+	assert.Equal(t, 1, cache.Len())
+	_, err := cache.Load(ctx, deleted.GetId(), deleted.GetType(), newfn)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+
+	assert.NoError(t, cache.Archive(ctx, archived.GetId(), archived.GetType()))
+	assert.Equal(t, 0, cache.Len())
+	agg, err := cache.Load(ctx, archived.GetId(), archived.GetType(), newfn)
+	assert.NoError(t, err, "failed to load archived aggregate")
+	assert.False(t, agg == event.Aggregator(archived), "archived aggregate must be reloaded")
+	assert.Equal(t, 50, agg.(*BalanceAggregator).Balance)
+
+	cache.Release(ctx, agg)
+	cache.Forget(ctx, archived.GetId(), archived.GetType())
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, uint64(3), cache.Stats().Evictions)
+}
+
+func TestAggregateCacheDropsCommittedEvents(t *testing.T) {
+	ctx := context.TODO()
+	repo := memory.New()
+	cache := eventstore.NewAggregateCache(repo, 1, 0)
+	newfn := func() event.Aggregator { return newBalance() }
+
+	balance := newBalance()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, balance.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 10})))
+	}
+	assert.NoError(t, repo.Save(ctx, balance.ListUncommittedEvents()))
+
+	agg, err := cache.Load(ctx, balance.GetId(), balance.GetType(), newfn)
+	assert.NoError(t, err, "failed to load aggregate")
+	assert.Len(t, agg.ListCommittedEvents(), 3)
+
+	// Cached aggregate keeps its state without committed events
+	cache.Release(ctx, agg)
+	assert.Len(t, agg.ListCommittedEvents(), 0)
+
+	agg, err = cache.Load(ctx, balance.GetId(), balance.GetType(), newfn)
+	assert.NoError(t, err, "failed to load aggregate")
+	assert.Equal(t, 30, agg.(*BalanceAggregator).Balance)
+	assert.Equal(t, event.Version(3), agg.GetVersion())
+}
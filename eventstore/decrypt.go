@@ -0,0 +1,117 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+var ErrNotSupported = errors.New("operation is not supported by repository")
+
+// BindPayloads binds encrypted payloads of streams to their events before
+// they are signed and chained, see event.BindEncryption. Returned unbind
+// puts unbound payloads back into the events once they are saved, so the
+// caller still decodes them, e.g. to publish saved events. Hashes and
+// signatures of the events cover the saved payloads. If any payload fails,
+// payloads of all streams are restored.
+func BindPayloads(streams ...[]event.Eventer) (unbind func(), err error) {
+	type bound struct {
+		evt     event.Eventer
+		payload event.Payload
+	}
+	var binds []bound
+	unbind = func() {
+		for _, b := range binds {
+			b.evt.SetPayload(b.payload)
+		}
+	}
+
+	for _, events := range streams {
+		for _, evt := range events {
+			payload := evt.GetPayload()
+			if err := event.BindEncryption(evt); err != nil {
+				unbind()
+				return nil, err
+			}
+			if !bytes.Equal(payload, evt.GetPayload()) {
+				binds = append(binds, bound{evt: evt, payload: payload})
+			}
+		}
+	}
+	return unbind, nil
+}
+
+// DecryptPayloads decrypts payloads of read events, see event.DecryptEvent.
+func DecryptPayloads(events []event.Eventer) error {
+	for _, evt := range events {
+		if err := event.DecryptEvent(evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptingRepository decrypts payloads of all read events, so transitions
+// and projections receive plaintext payloads regardless of the backend.
+type decryptingRepository struct {
+	repo Repository
+}
+
+var (
+	_ (Repository)      = &decryptingRepository{}
+	_ (MultiSaver)      = &decryptingRepository{}
+	_ (IdempotentSaver) = &decryptingRepository{}
+)
+
+// NewDecryptingRepository wraps repo and decrypts payloads of events
+// encoded with event.EncryptingSerializer on every read. Decrypted events
+// carry the serializer type the payload was encoded with before encryption.
+// Repositories of this module decrypt payloads themselves, the wrapper is
+// intended for other implementations of Repository.
+func NewDecryptingRepository(repo Repository) *decryptingRepository {
+	return &decryptingRepository{repo: repo}
+}
+
+func (r *decryptingRepository) Get(ctx context.Context, aggregateID, aggregateType string, version event.Version) (event.Eventer, error) {
+	evt, err := r.repo.Get(ctx, aggregateID, aggregateType, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := event.DecryptEvent(evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+func (r *decryptingRepository) List(ctx context.Context, aggregateID, aggregateType string, filter *ListFilter) ([]event.Eventer, error) {
+	events, err := r.repo.List(ctx, aggregateID, aggregateType, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := DecryptPayloads(events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *decryptingRepository) Save(ctx context.Context, events []event.Eventer) error {
+	return r.repo.Save(ctx, events)
+}
+
+func (r *decryptingRepository) SaveMulti(ctx context.Context, streams [][]event.Eventer) error {
+	saver, ok := r.repo.(MultiSaver)
+	if !ok {
+		return ErrNotSupported
+	}
+	return saver.SaveMulti(ctx, streams)
+}
+
+func (r *decryptingRepository) SaveIdempotent(ctx context.Context, events []event.Eventer) (bool, error) {
+	saver, ok := r.repo.(IdempotentSaver)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	return saver.SaveIdempotent(ctx, events)
+}
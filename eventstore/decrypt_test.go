@@ -0,0 +1,40 @@
+package eventstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/memory"
+)
+
+func TestDecryptingRepository(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, event.WriteKeyFile(dir, "key_0"))
+	keys, err := event.NewFileKeyProvider(dir, "key_0")
+	assert.NoError(t, err, "failed to load keys")
+
+	typ, err := event.RegisterEncryptingSerializer(event.SerializerTypeJSON, keys)
+	assert.NoError(t, err, "failed to register serializer")
+
+	ctx := context.TODO()
+	repo := eventstore.NewDecryptingRepository(memory.New())
+
+	agg := newBalance()
+	evt, err := event.NewWithSerializer("changed", balanceChangedEvent{Amount: 100}, typ)
+	assert.NoError(t, err, "failed to create event")
+	assert.NoError(t, agg.Apply(evt))
+	assert.NoError(t, repo.Save(ctx, agg.ListUncommittedEvents()))
+
+	events, err := repo.List(ctx, agg.GetId(), agg.GetType(), nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, event.SerializerTypeJSON, events[0].GetSerializer())
+	assert.JSONEq(t, `{"Amount":100}`, string(events[0].GetPayload()))
+
+	got, err := repo.Get(ctx, agg.GetId(), agg.GetType(), 1)
+	assert.NoError(t, err, "failed to get event")
+	assert.Equal(t, event.SerializerTypeJSON, got.GetSerializer())
+}
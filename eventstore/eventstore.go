@@ -1,7 +1,11 @@
 package eventstore
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/0x9ef/eventsourcing-go/event"
 )
@@ -12,8 +16,194 @@ type Repository interface {
 	Save(ctx context.Context, events []event.Eventer) error
 }
 
+// MultiSaver is implemented by repositories that are able to save events
+// of several aggregates in one transaction. Each element of streams holds
+// events of exactly one aggregate, the optimistic concurrency check is
+// performed for every aggregate separately and either all streams are
+// saved or none.
+type MultiSaver interface {
+	SaveMulti(ctx context.Context, streams [][]event.Eventer) error
+}
+
+// IdempotentSaver is implemented by repositories that deduplicate events by
+// their idempotency keys. If all keyed events of the batch were already
+// saved, nothing is written and replayed is true. If only part of them was
+// saved ErrIdempotencyConflict is returned.
+type IdempotentSaver interface {
+	SaveIdempotent(ctx context.Context, events []event.Eventer) (replayed bool, err error)
+}
+
+// Verifier is implemented by repositories that chain hashes of events. Verify
+// walks the stream and returns *ChainError describing the first broken link.
+type Verifier interface {
+	Verify(ctx context.Context, aggregateID, aggregateType string) error
+}
+
+// StreamDeleter is implemented by repositories that are able to delete
+// streams. SoftDelete appends tombstone event, after which appends are
+// rejected with *StreamDeletedError. HardDelete physically deletes all
+// events of the stream, e.g. for compliance reasons.
+type StreamDeleter interface {
+	SoftDelete(ctx context.Context, aggregateID, aggregateType string) error
+	HardDelete(ctx context.Context, aggregateID, aggregateType string) error
+}
+
+// Archiver is implemented by repositories that are able to move cold streams
+// into archive storage. Archived events are still returned by Get and List.
+type Archiver interface {
+	Archive(ctx context.Context, aggregateID, aggregateType string) error
+}
+
+// Truncater is implemented by repositories that are able to truncate streams.
+// Events before the version are hidden from all reads, e.g. when they are
+// covered by a snapshot, and may be physically deleted later. Version above
+// the last one is clamped to it, so the last event is never hidden, and the
+// truncation point never moves backwards. Truncating an empty stream fails
+// with ErrEventNotFound.
+type Truncater interface {
+	TruncateBefore(ctx context.Context, aggregateID, aggregateType string, version event.Version) error
+}
+
 type ListFilter struct {
 	AfterVersion  event.Version
 	BeforeVersion event.Version
-	Limit         int
+	// AfterTime and BeforeTime bound event timestamps, AfterTime is
+	// inclusive.
+	AfterTime  time.Time
+	BeforeTime time.Time
+	Limit      int
+}
+
+var (
+	ErrControlConcurrency  = errors.New("concurrency error")
+	ErrEventNotFound       = errors.New("event not found")
+	ErrMixedAggregates     = errors.New("events belong to different aggregates")
+	ErrIdempotencyConflict = errors.New("idempotency keys were partially replayed")
+	ErrChainBroken         = errors.New("hash chain is broken")
+	ErrLockTimeout         = errors.New("lock timeout")
+	ErrStreamDeleted       = errors.New("stream is deleted")
+)
+
+// ValidateStream checks that all events belong to the same aggregate.
+func ValidateStream(events []event.Eventer) error {
+	for _, evt := range events[1:] {
+		if evt.GetAggregateId() != events[0].GetAggregateId() ||
+			evt.GetAggregateType() != events[0].GetAggregateType() {
+			return ErrMixedAggregates
+		}
+	}
+	return nil
+}
+
+// IdempotencyKeys returns non-empty idempotency keys of events.
+func IdempotencyKeys(events []event.Eventer) []string {
+	keys := make([]string, 0, len(events))
+	for _, evt := range events {
+		if key := evt.GetIdempotencyKey(); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// TruncateTimestamps truncates timestamps of events to microseconds. SQL
+// stores keep timestamps with microsecond precision and round finer ones,
+// so timestamps are truncated before events are signed, chained and saved,
+// otherwise hashes and signatures of read events won't match.
+func TruncateTimestamps(events []event.Eventer) {
+	for _, evt := range events {
+		evt.SetTimestamp(event.Timestamp(time.Time(evt.GetTimestamp()).Truncate(time.Microsecond)))
+	}
+}
+
+// ChainHashes sets previous and own hashes of events, prev is the hash of
+// the last already saved event of the stream.
+func ChainHashes(prev event.Hash, events []event.Eventer) {
+	for _, evt := range events {
+		evt.SetPrevHash(prev)
+		evt.SetHash(event.ChainHash(prev, evt))
+		prev = evt.GetHash()
+	}
+}
+
+// ChainError describes the first broken link of the hash chain.
+type ChainError struct {
+	Version event.Version
+	Reason  string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("hash chain is broken at version %d: %s", e.Version, e.Reason)
+}
+
+func (e *ChainError) Unwrap() error {
+	return ErrChainBroken
+}
+
+// VerifyChain verifies hash chain of events of a single stream ordered
+// by version. Events saved before hashes were introduced (see
+// UpgradeMigrations of the PostgreSQL stores) have no hash, the chain is
+// verified from the first hashed event.
+func VerifyChain(events []event.Eventer) error {
+	return VerifyChainFrom(nil, events)
+}
+
+// VerifyChainFrom verifies hash chain which continues from prev hash, e.g.
+// chain of the truncated stream. Leading events without hash are skipped,
+// the first hashed event after them starts the chain.
+func VerifyChainFrom(prev event.Hash, events []event.Eventer) error {
+	unhashed := 0
+	for unhashed < len(events) && len(events[unhashed].GetHash()) == 0 {
+		unhashed++
+	}
+	if unhashed > 0 {
+		prev, events = nil, events[unhashed:]
+	}
+
+	for i, evt := range events {
+		if i > 0 && evt.GetVersion() != events[i-1].GetVersion()+event.NextVersion {
+			return &ChainError{Version: evt.GetVersion(), Reason: "version gap"}
+		}
+		if !bytes.Equal(evt.GetPrevHash(), prev) {
+			return &ChainError{Version: evt.GetVersion(), Reason: "previous hash mismatch"}
+		}
+		if !bytes.Equal(evt.GetHash(), event.ChainHash(prev, evt)) {
+			return &ChainError{Version: evt.GetVersion(), Reason: "hash mismatch"}
+		}
+		prev = evt.GetHash()
+	}
+	return nil
+}
+
+// ConcurrencyError is returned when events are saved at version which is
+// already taken by another writer. It matches ErrControlConcurrency with
+// errors.Is.
+type ConcurrencyError struct {
+	AggregateId   string
+	AggregateType string
+	Version       event.Version
+}
+
+func (e *ConcurrencyError) Error() string {
+	return fmt.Sprintf("stream %s/%s has no free version %d: %s", e.AggregateType, e.AggregateId, e.Version, ErrControlConcurrency)
+}
+
+func (e *ConcurrencyError) Unwrap() error {
+	return ErrControlConcurrency
+}
+
+// StreamDeletedError is returned when events are appended to the stream
+// closed by tombstone.
+type StreamDeletedError struct {
+	AggregateId   string
+	AggregateType string
+	Version       event.Version
+}
+
+func (e *StreamDeletedError) Error() string {
+	return fmt.Sprintf("stream %s/%s is deleted at version %d", e.AggregateType, e.AggregateId, e.Version)
+}
+
+func (e *StreamDeletedError) Unwrap() error {
+	return ErrStreamDeleted
 }
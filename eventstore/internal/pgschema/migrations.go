@@ -0,0 +1,215 @@
+package pgschema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// columnDefinitions returns column definitions of the event table.
+func columnDefinitions(cfg Config) string {
+	c := cfg.Columns.Quoted()
+	return `
+		` + c.TenantId + ` VARCHAR(128) NOT NULL DEFAULT '',
+		` + c.AggregateId + ` VARCHAR(128) NOT NULL,
+		` + c.AggregateType + ` VARCHAR(128) NOT NULL,
+		` + c.Reason + ` TEXT NOT NULL,
+		` + c.Version + ` SMALLINT NOT NULL,
+		` + c.Timestamp + ` TIMESTAMPTZ NOT NULL,
+		` + c.Payload + ` ` + string(cfg.PayloadType) + `,
+		` + c.Serializer + ` VARCHAR(32),
+		` + c.IdempotencyKey + ` VARCHAR(128),
+		` + c.Hash + ` bytea,
+		` + c.PrevHash + ` bytea,
+		` + c.Metadata + ` JSONB,
+		` + c.Signature + ` bytea,
+		` + c.SignatureKeyId + ` VARCHAR(128)
+	`
+}
+
+// Suffixes of unique index names of the event table, unique violations are
+// told apart by them.
+const (
+	VersionIndexSuffix     = "_id_type_version_un"
+	IdempotencyIndexSuffix = "_idempotency_key_un"
+)
+
+// index returns quoted name of the event table index.
+func index(cfg Config, suffix string) string {
+	return QuoteIdent(cfg.Table + suffix)
+}
+
+// CreateMigrations create the event table described by config. JSONB
+// payloads are indexed with GIN index, e.g. for containment queries:
+//
+//	SELECT * FROM es_events WHERE payload @> '{"status": "paid"}'
+func CreateMigrations(cfg Config) []string {
+	cfg = cfg.WithDefaults()
+	c := cfg.Columns.Quoted()
+	table := cfg.EventTable().String()
+
+	stmts := []string{
+		"CREATE TABLE " + table + " (" + columnDefinitions(cfg) + ");",
+		"CREATE UNIQUE INDEX " + index(cfg, VersionIndexSuffix) + " ON " + table + " (" + strings.Join([]string{c.TenantId, c.AggregateId, c.AggregateType, c.Version}, ", ") + ");",
+		"CREATE INDEX " + index(cfg, "_id_type_idx") + " ON " + table + " (" + strings.Join([]string{c.TenantId, c.AggregateId, c.AggregateType}, ", ") + ");",
+		"CREATE UNIQUE INDEX " + index(cfg, IdempotencyIndexSuffix) + " ON " + table + " (" + c.TenantId + ", " + c.IdempotencyKey + ") WHERE " + c.IdempotencyKey + " IS NOT NULL;",
+	}
+	return append(stmts, payloadIndex(cfg)...)
+}
+
+// legacyIndexes are names of indexes created by the first releases, they
+// weren't prefixed with the table name.
+var legacyIndexes = []string{"id_type_version_un", "id_type_idx", "idempotency_key_un"}
+
+// UpgradeMigrations upgrade the event table created by earlier releases to
+// the layout of CreateMigrations: missing columns are added, serializer
+// column is widened and indexes are recreated with the tenant. Statements
+// are idempotent, so they are safe to run on up to date tables. Existing
+// events are left without hashes, the hash chain of the stream starts from
+// the first event saved after the upgrade. Partitioned tables are created
+// with all columns and need no upgrade.
+func UpgradeMigrations(cfg Config) []string {
+	cfg = cfg.WithDefaults()
+	c := cfg.Columns.Quoted()
+	table := cfg.EventTable().String()
+
+	stmts := []string{
+		"ALTER TABLE " + table +
+			" ADD COLUMN IF NOT EXISTS " + c.TenantId + " VARCHAR(128) NOT NULL DEFAULT ''," +
+			" ADD COLUMN IF NOT EXISTS " + c.IdempotencyKey + " VARCHAR(128)," +
+			" ADD COLUMN IF NOT EXISTS " + c.Hash + " bytea," +
+			" ADD COLUMN IF NOT EXISTS " + c.PrevHash + " bytea," +
+			" ADD COLUMN IF NOT EXISTS " + c.Metadata + " JSONB," +
+			" ADD COLUMN IF NOT EXISTS " + c.Signature + " bytea," +
+			" ADD COLUMN IF NOT EXISTS " + c.SignatureKeyId + " VARCHAR(128)," +
+			" ALTER COLUMN " + c.Serializer + " TYPE VARCHAR(32);",
+	}
+	for _, name := range legacyIndexes {
+		stmts = append(stmts, "DROP INDEX IF EXISTS "+Table{Schema: cfg.Schema, Name: name}.String()+";")
+	}
+
+	// Indexes are created as by CreateMigrations, unless they already exist
+	for _, stmt := range CreateMigrations(cfg)[1:] {
+		stmts = append(stmts, strings.Replace(stmt, "INDEX ", "INDEX IF NOT EXISTS ", 1))
+	}
+	return stmts
+}
+
+func payloadIndex(cfg Config) []string {
+	if cfg.PayloadType != PayloadJSONB {
+		return nil
+	}
+	return []string{"CREATE INDEX " + index(cfg, "_payload_gin") + " ON " + cfg.EventTable().String() + " USING GIN (" + QuoteIdent(cfg.Columns.Payload) + " jsonb_path_ops);"}
+}
+
+// TimePartitionMigrations are used instead of CreateMigrations, they create
+// the event table partitioned by month of the event timestamp with partitions
+// of the current and the next month. Unique indexes of the partitioned table
+// have to contain the timestamp, so stream versions and idempotency keys are
+// kept unique by advisory locks. Events outside of created partitions go to
+// the DEFAULT partition.
+func TimePartitionMigrations(cfg Config) []string {
+	cfg = cfg.WithDefaults()
+	c := cfg.Columns.Quoted()
+	table := cfg.EventTable().String()
+
+	stmts := []string{
+		"CREATE TABLE " + table + " (" + columnDefinitions(cfg) + ") PARTITION BY RANGE (" + c.Timestamp + ");",
+		"CREATE UNIQUE INDEX " + index(cfg, VersionIndexSuffix) + " ON " + table + " (" + strings.Join([]string{c.TenantId, c.AggregateId, c.AggregateType, c.Version, c.Timestamp}, ", ") + ");",
+		"CREATE INDEX " + index(cfg, "_id_type_idx") + " ON " + table + " (" + strings.Join([]string{c.TenantId, c.AggregateId, c.AggregateType}, ", ") + ");",
+		"CREATE INDEX " + index(cfg, "_idempotency_key_idx") + " ON " + table + " (" + c.TenantId + ", " + c.IdempotencyKey + ") WHERE " + c.IdempotencyKey + " IS NOT NULL;",
+		"CREATE TABLE " + cfg.EventTable().DefaultPartition().String() + " PARTITION OF " + table + " DEFAULT;",
+	}
+	month := MonthStart(time.Now())
+	for _, month := range []time.Time{month, month.AddDate(0, 1, 0)} {
+		stmts = append(stmts, "CREATE TABLE "+cfg.EventTable().MonthPartition(month).String()+" PARTITION OF "+table+" FOR VALUES "+MonthBounds(month)+";")
+	}
+	return append(stmts, payloadIndex(cfg)...)
+}
+
+// MonthBounds returns partition bounds of the month, e.g. for
+// ATTACH PARTITION.
+func MonthBounds(month time.Time) string {
+	return "FROM (" + QuoteLiteral(month.Format(time.RFC3339)) + ") TO (" + QuoteLiteral(month.AddDate(0, 1, 0).Format(time.RFC3339)) + ")"
+}
+
+// HashPartitionMigrations are used instead of CreateMigrations, they create
+// the event table partitioned by hash of the aggregate id. Every stream
+// lives in a single partition, so stream reads and appends touch one
+// partition only. Unique indexes have to contain the aggregate id, so
+// idempotency keys are kept unique per tenant by the advisory lock.
+func HashPartitionMigrations(cfg Config, partitions int) []string {
+	cfg = cfg.WithDefaults()
+	c := cfg.Columns.Quoted()
+	table := cfg.EventTable().String()
+
+	stmts := []string{
+		"CREATE TABLE " + table + " (" + columnDefinitions(cfg) + ") PARTITION BY HASH (" + c.AggregateId + ");",
+		"CREATE UNIQUE INDEX " + index(cfg, VersionIndexSuffix) + " ON " + table + " (" + strings.Join([]string{c.TenantId, c.AggregateId, c.AggregateType, c.Version}, ", ") + ");",
+		"CREATE INDEX " + index(cfg, "_id_type_idx") + " ON " + table + " (" + strings.Join([]string{c.TenantId, c.AggregateId, c.AggregateType}, ", ") + ");",
+		"CREATE UNIQUE INDEX " + index(cfg, IdempotencyIndexSuffix) + " ON " + table + " (" + strings.Join([]string{c.TenantId, c.IdempotencyKey, c.AggregateId}, ", ") + ") WHERE " + c.IdempotencyKey + " IS NOT NULL;",
+	}
+	stmts = append(stmts, payloadIndex(cfg)...)
+	for i := 0; i < partitions; i++ {
+		stmts = append(stmts, fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES WITH (MODULUS %d, REMAINDER %d);",
+			cfg.EventTable().Suffixed(fmt.Sprintf("_p%d", i)), table, partitions, i))
+	}
+	return stmts
+}
+
+// ArchiveMigrations create the archive table with the same structure as the
+// event table.
+func ArchiveMigrations(cfg Config) []string {
+	return []string{
+		"CREATE TABLE " + cfg.EventTable().Archive().String() + " (LIKE " + cfg.EventTable().String() + " INCLUDING ALL);",
+	}
+}
+
+// TruncationMigrations create the table with truncation points of streams.
+func TruncationMigrations(cfg Config) []string {
+	return []string{
+		`CREATE TABLE ` + cfg.EventTable().Streams().String() + ` (
+		tenant_id       VARCHAR(128) NOT NULL DEFAULT '',
+		aggregate_id    VARCHAR(128) NOT NULL,
+		aggregate_type  VARCHAR(128) NOT NULL,
+		truncate_before SMALLINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (tenant_id, aggregate_id, aggregate_type)
+	);`,
+	}
+}
+
+// RowLevelSecurityMigrations forbid access to rows of other tenants on the
+// database level. The table owner is subjected to policies as well. Archive
+// and streams tables get the same policy if they exist, so migrations should
+// be applied after ArchiveMigrations and TruncationMigrations.
+func RowLevelSecurityMigrations(cfg Config) []string {
+	cfg = cfg.WithDefaults()
+	table := cfg.EventTable()
+	tenant := QuoteIdent(cfg.Columns.TenantId)
+
+	stmts := rowLevelSecurity(table, tenant, index(cfg, "_tenant_isolation"))
+	optional := []struct {
+		table  Table
+		tenant string
+		policy string
+	}{
+		{table.Archive(), tenant, index(cfg, "_archive_tenant_isolation")},
+		{table.Streams(), QuoteIdent("tenant_id"), index(cfg, "_streams_tenant_isolation")},
+	}
+	for _, t := range optional {
+		stmts = append(stmts, "DO $$ BEGIN IF to_regclass("+QuoteLiteral(t.table.String())+") IS NOT NULL THEN "+
+			strings.Join(rowLevelSecurity(t.table, t.tenant, t.policy), " ")+" END IF; END $$;")
+	}
+	return stmts
+}
+
+// rowLevelSecurity returns statements enabling the tenant policy of the table.
+func rowLevelSecurity(table Table, tenant, policy string) []string {
+	return []string{
+		"ALTER TABLE " + table.String() + " ENABLE ROW LEVEL SECURITY;",
+		"ALTER TABLE " + table.String() + " FORCE ROW LEVEL SECURITY;",
+		`CREATE POLICY ` + policy + ` ON ` + table.String() + `
+		USING (` + tenant + ` = current_setting('` + TenantSetting + `', true))
+		WITH CHECK (` + tenant + ` = current_setting('` + TenantSetting + `', true));`,
+	}
+}
@@ -0,0 +1,54 @@
+package pgschema
+
+import "github.com/0x9ef/eventsourcing-go/event"
+
+// NormalizeQuery returns JSONB text representation of JSON payloads passed
+// as text array, in the order of the array.
+const NormalizeQuery = "SELECT p::jsonb::text FROM unnest($1::text[]) WITH ORDINALITY AS t(p, i) ORDER BY i"
+
+// JSONPayloads returns payloads of events to be normalized with
+// NormalizeQuery and indexes of their events. Events without payload are
+// skipped, payloads which are not JSON serialized are rejected with
+// ErrPayloadNotJSON.
+func JSONPayloads(events []event.Eventer) ([]string, []int, error) {
+	var (
+		payloads []string
+		indexes  []int
+	)
+	for i, evt := range events {
+		if len(evt.GetPayload()) == 0 {
+			continue
+		}
+		if evt.GetSerializer() != event.SerializerTypeJSON {
+			return nil, nil, ErrPayloadNotJSON
+		}
+		payloads = append(payloads, string(evt.GetPayload()))
+		indexes = append(indexes, i)
+	}
+	return payloads, indexes, nil
+}
+
+// Payloads holds payloads of events passed to save.
+type Payloads [][]event.Payload
+
+// KeepPayloads returns payloads of streams. Saves may replace payloads, e.g.
+// with normalized JSONB, they are restored if the save fails.
+func KeepPayloads(streams [][]event.Eventer) Payloads {
+	kept := make(Payloads, len(streams))
+	for i, events := range streams {
+		kept[i] = make([]event.Payload, len(events))
+		for j, evt := range events {
+			kept[i][j] = evt.GetPayload()
+		}
+	}
+	return kept
+}
+
+// Restore puts payloads back into events of streams.
+func (p Payloads) Restore(streams [][]event.Eventer) {
+	for i, events := range streams {
+		for j, evt := range events {
+			evt.SetPayload(p[i][j])
+		}
+	}
+}
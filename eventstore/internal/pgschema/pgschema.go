@@ -0,0 +1,240 @@
+// Package pgschema describes the PostgreSQL event table layout shared by
+// the postgresql and pgxstore stores and builds its migrations. All
+// identifiers are quoted, so schema, table and column names are used
+// exactly as configured.
+package pgschema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Config describes layout of the event table.
+type Config struct {
+	// Schema of the event table, table name is not qualified if empty.
+	Schema  string
+	Table   string
+	Columns Columns
+	// PayloadType is type of the payload column, PayloadBytea by default.
+	PayloadType PayloadType
+}
+
+// PayloadType is type of the payload column.
+type PayloadType string
+
+const (
+	PayloadBytea PayloadType = "bytea"
+	// PayloadJSONB stores payloads as JSONB, so payload fields can be
+	// queried with SQL. Only JSON serialized events can be saved.
+	PayloadJSONB PayloadType = "jsonb"
+)
+
+var (
+	ErrPayloadNotJSON   = errors.New("payload is not JSON serialized")
+	ErrInvalidTableName = errors.New("invalid table name")
+)
+
+// TenantSetting is a transaction setting with the current tenant id, it's
+// checked by row level security policies.
+const TenantSetting = "es.tenant_id"
+
+// Columns are names of the event table columns, empty names are defaulted
+// to names used by CreateMigrations with the default config.
+type Columns struct {
+	TenantId       string
+	AggregateId    string
+	AggregateType  string
+	Reason         string
+	Version        string
+	Timestamp      string
+	Payload        string
+	Serializer     string
+	IdempotencyKey string
+	Hash           string
+	PrevHash       string
+	Metadata       string
+	Signature      string
+	SignatureKeyId string
+}
+
+// WithDefaults returns config with defaulted column names and payload type.
+func (cfg Config) WithDefaults() Config {
+	cfg.Columns = cfg.Columns.withDefaults()
+	if cfg.PayloadType == "" {
+		cfg.PayloadType = PayloadBytea
+	}
+	return cfg
+}
+
+// EventTable returns the event table described by config.
+func (cfg Config) EventTable() Table {
+	return Table{Schema: cfg.Schema, Name: cfg.Table}
+}
+
+func (c Columns) withDefaults() Columns {
+	defaulted := func(name *string, def string) {
+		if *name == "" {
+			*name = def
+		}
+	}
+	defaulted(&c.TenantId, "tenant_id")
+	defaulted(&c.AggregateId, "aggregate_id")
+	defaulted(&c.AggregateType, "aggregate_type")
+	defaulted(&c.Reason, "reason")
+	defaulted(&c.Version, "version")
+	defaulted(&c.Timestamp, "tstamp")
+	defaulted(&c.Payload, "payload")
+	defaulted(&c.Serializer, "serializer")
+	defaulted(&c.IdempotencyKey, "idempotency_key")
+	defaulted(&c.Hash, "hash")
+	defaulted(&c.PrevHash, "prev_hash")
+	defaulted(&c.Metadata, "metadata")
+	defaulted(&c.Signature, "signature")
+	defaulted(&c.SignatureKeyId, "signature_key_id")
+	return c
+}
+
+// Quoted returns columns with quoted names, ready to be used in SQL.
+func (c Columns) Quoted() Columns {
+	return Columns{
+		TenantId:       QuoteIdent(c.TenantId),
+		AggregateId:    QuoteIdent(c.AggregateId),
+		AggregateType:  QuoteIdent(c.AggregateType),
+		Reason:         QuoteIdent(c.Reason),
+		Version:        QuoteIdent(c.Version),
+		Timestamp:      QuoteIdent(c.Timestamp),
+		Payload:        QuoteIdent(c.Payload),
+		Serializer:     QuoteIdent(c.Serializer),
+		IdempotencyKey: QuoteIdent(c.IdempotencyKey),
+		Hash:           QuoteIdent(c.Hash),
+		PrevHash:       QuoteIdent(c.PrevHash),
+		Metadata:       QuoteIdent(c.Metadata),
+		Signature:      QuoteIdent(c.Signature),
+		SignatureKeyId: QuoteIdent(c.SignatureKeyId),
+	}
+}
+
+// ReadColumns are selected by all read paths.
+func (c Columns) ReadColumns() []string {
+	return []string{
+		c.TenantId,
+		c.AggregateId,
+		c.AggregateType,
+		c.Reason,
+		c.Version,
+		c.Timestamp,
+		c.Payload,
+		c.Serializer,
+		c.Hash,
+		c.PrevHash,
+		c.Metadata,
+		c.Signature,
+		c.SignatureKeyId,
+	}
+}
+
+// WriteColumns are written by saves.
+func (c Columns) WriteColumns() []string {
+	return []string{
+		c.TenantId,
+		c.AggregateId,
+		c.AggregateType,
+		c.Reason,
+		c.Version,
+		c.Timestamp,
+		c.Payload,
+		c.Serializer,
+		c.IdempotencyKey,
+		c.Hash,
+		c.PrevHash,
+		c.Metadata,
+		c.Signature,
+		c.SignatureKeyId,
+	}
+}
+
+// Table is the table name, optionally schema qualified.
+type Table struct {
+	Schema string
+	Name   string
+}
+
+// String returns quoted table name.
+func (t Table) String() string {
+	if t.Schema == "" {
+		return QuoteIdent(t.Name)
+	}
+	return QuoteIdent(t.Schema) + "." + QuoteIdent(t.Name)
+}
+
+// Suffixed returns table of the same schema, which name is suffixed, e.g.
+// "es_events_archive" for the archive table of "es_events".
+func (t Table) Suffixed(suffix string) Table {
+	return Table{Schema: t.Schema, Name: t.Name + suffix}
+}
+
+// Archive returns the archive table of the event table.
+func (t Table) Archive() Table {
+	return t.Suffixed("_archive")
+}
+
+// Streams returns the table with per-stream settings of the event table.
+func (t Table) Streams() Table {
+	return t.Suffixed("_streams")
+}
+
+// DefaultPartition returns the DEFAULT partition of the time partitioned
+// event table.
+func (t Table) DefaultPartition() Table {
+	return t.Suffixed("_default")
+}
+
+// MonthPartition returns the partition of the time partitioned event table
+// with events of the month, e.g. "es_events_2024_01".
+func (t Table) MonthPartition(month time.Time) Table {
+	return t.Suffixed(fmt.Sprintf("_%04d_%02d", month.Year(), month.Month()))
+}
+
+// MonthStart returns the first instant of the UTC month of t, time
+// partitions are bounded by UTC months.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// QuoteIdent quotes identifier, so it's used in SQL as is.
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteLiteral quotes string literal, e.g. for DDL statements which don't
+// accept parameters.
+func QuoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// TableOf returns table of the name, which may be schema qualified, e.g.
+// "public.es_events".
+func TableOf(name string) Table {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return Table{Schema: schema, Name: table}
+	}
+	return Table{Name: name}
+}
+
+// tableName matches unquoted, optionally schema qualified, table names.
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ParseTable returns table of the unquoted, optionally schema qualified,
+// name. Names with characters other than letters, digits and underscores
+// are rejected with ErrInvalidTableName, e.g. names built from untrusted
+// input.
+func ParseTable(name string) (Table, error) {
+	if !tableName.MatchString(name) {
+		return Table{}, ErrInvalidTableName
+	}
+	return TableOf(name), nil
+}
@@ -0,0 +1,105 @@
+package pgschema
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	assert.Equal(t, `"es_events"`, QuoteIdent("es_events"))
+	assert.Equal(t, `"es""; DROP TABLE x; --"`, QuoteIdent(`es"; DROP TABLE x; --`))
+	assert.Equal(t, `'it''s'`, QuoteLiteral("it's"))
+}
+
+func TestTable(t *testing.T) {
+	table := TableOf("payments.es_events")
+	assert.Equal(t, Table{Schema: "payments", Name: "es_events"}, table)
+	assert.Equal(t, `"payments"."es_events"`, table.String())
+	assert.Equal(t, `"payments"."es_events_archive"`, table.Archive().String())
+	assert.Equal(t, `"payments"."es_events_streams"`, table.Streams().String())
+	assert.Equal(t, `"es_events"`, TableOf("es_events").String())
+}
+
+func TestCreateMigrations(t *testing.T) {
+	cfg := Config{
+		Schema:      "Payments",
+		Table:       "Events",
+		Columns:     Columns{AggregateId: "Stream Id"},
+		PayloadType: PayloadJSONB,
+	}
+
+	stmts := CreateMigrations(cfg)
+	assert.Contains(t, stmts[0], `CREATE TABLE "Payments"."Events" (`)
+	assert.Contains(t, stmts[0], `"Stream Id" VARCHAR(128) NOT NULL`)
+	assert.Contains(t, stmts[0], `"payload" jsonb`)
+	assert.Equal(t, `CREATE UNIQUE INDEX "Events_id_type_version_un" ON "Payments"."Events" ("tenant_id", "Stream Id", "aggregate_type", "version");`, stmts[1])
+	assert.True(t, strings.HasPrefix(stmts[len(stmts)-1], `CREATE INDEX "Events_payload_gin"`))
+
+	assert.Equal(t, []string{`CREATE TABLE "Payments"."Events_archive" (LIKE "Payments"."Events" INCLUDING ALL);`}, ArchiveMigrations(cfg))
+	assert.Contains(t, TruncationMigrations(cfg)[0], `CREATE TABLE "Payments"."Events_streams"`)
+	assert.Contains(t, RowLevelSecurityMigrations(cfg)[2], `USING ("tenant_id" = current_setting('es.tenant_id', true))`)
+	assert.Contains(t, RowLevelSecurityMigrations(cfg)[3], `IF to_regclass('"Payments"."Events_archive"') IS NOT NULL`)
+	assert.Contains(t, RowLevelSecurityMigrations(cfg)[4], `CREATE POLICY "Events_streams_tenant_isolation" ON "Payments"."Events_streams"`)
+}
+
+func TestUpgradeMigrations(t *testing.T) {
+	cfg := Config{Schema: "public", Table: "es_events"}
+
+	stmts := UpgradeMigrations(cfg)
+	assert.Contains(t, stmts[0], `ADD COLUMN IF NOT EXISTS "tenant_id" VARCHAR(128) NOT NULL DEFAULT ''`)
+	assert.Contains(t, stmts[0], `ADD COLUMN IF NOT EXISTS "signature_key_id" VARCHAR(128)`)
+	assert.Contains(t, stmts[0], `ALTER COLUMN "serializer" TYPE VARCHAR(32)`)
+	assert.Contains(t, stmts, `DROP INDEX IF EXISTS "public"."id_type_version_un";`)
+	assert.Contains(t, stmts, `CREATE UNIQUE INDEX IF NOT EXISTS "es_events_id_type_version_un" ON "public"."es_events" ("tenant_id", "aggregate_id", "aggregate_type", "version");`)
+}
+
+func TestTimePartitionMigrations(t *testing.T) {
+	month := MonthStart(time.Now())
+	stmts := TimePartitionMigrations(Config{Table: "es_events"})
+	assert.Contains(t, stmts, `CREATE TABLE "es_events_default" PARTITION OF "es_events" DEFAULT;`)
+	for _, month := range []time.Time{month, month.AddDate(0, 1, 0)} {
+		assert.Contains(t, stmts, `CREATE TABLE `+Table{Name: "es_events"}.MonthPartition(month).String()+` PARTITION OF "es_events" FOR VALUES `+MonthBounds(month)+`;`)
+	}
+}
+
+func TestPartitionMigrations(t *testing.T) {
+	table := Table{Name: "es_events"}
+	month := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := Config{}.WithDefaults().Columns.Quoted()
+
+	stmts := PartitionMigrations(table, c, month, false)
+	assert.Equal(t, []string{
+		`CREATE TABLE "es_events_2024_01" (LIKE "es_events" INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`,
+		`ALTER TABLE "es_events" ATTACH PARTITION "es_events_2024_01" FOR VALUES FROM ('2024-01-01T00:00:00Z') TO ('2024-02-01T00:00:00Z')`,
+	}, stmts)
+
+	stmts = PartitionMigrations(table, c, month, true)
+	assert.Equal(t, `LOCK TABLE "es_events_default" IN ACCESS EXCLUSIVE MODE`, stmts[1])
+	assert.Equal(t, `WITH moved AS (DELETE FROM "es_events_default" WHERE "tstamp" >= '2024-01-01T00:00:00Z' AND "tstamp" < '2024-02-01T00:00:00Z' RETURNING *) INSERT INTO "es_events_2024_01" SELECT * FROM moved`, stmts[2])
+}
+
+func TestScavengeQuery(t *testing.T) {
+	table := Table{Name: "es_events"}
+	c := Config{}.WithDefaults().Columns.Quoted()
+
+	q := ScavengeQuery(table, c, false)
+	assert.True(t, strings.HasPrefix(q, `DELETE FROM "es_events" WHERE (tableoid, ctid) IN (`))
+	assert.Contains(t, q, `JOIN "es_events_streams" s`)
+	assert.Equal(t, `WITH scavenged AS (`+q+` RETURNING *) INSERT INTO "es_events_archive" SELECT * FROM scavenged`, ScavengeQuery(table, c, true))
+}
+
+func TestRetentionArgs(t *testing.T) {
+	types, ids, maxAges, maxCounts := RetentionArgs([]RetentionRule{
+		{AggregateType: "Invoice", MaxAge: time.Second},
+		{AggregateType: "Receipt"},
+		{AggregateType: "Order", MaxCount: 10},
+		{AggregateType: "Order", AggregateId: "order_0"},
+	})
+	assert.Equal(t, []string{"Invoice", "Order", "Order"}, types, "type rules without limits must be skipped")
+	assert.Equal(t, []string{"", "", "order_0"}, ids, "stream rules without limits must be kept")
+	assert.Equal(t, []int64{1000000, 0, 0}, maxAges)
+	assert.Equal(t, []int64{0, 10, 0}, maxCounts)
+}
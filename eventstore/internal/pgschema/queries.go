@@ -0,0 +1,193 @@
+package pgschema
+
+import (
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+// SetTenantQuery scopes the transaction to the tenant, so row level
+// security policies are applied (see RowLevelSecurityMigrations).
+const SetTenantQuery = "SELECT set_config('" + TenantSetting + "', $1, true)"
+
+// SetLockTimeoutQuery sets lock_timeout of the transaction, e.g. "100ms".
+const SetLockTimeoutQuery = "SELECT set_config('lock_timeout', $1, true)"
+
+// Transaction advisory locks of streams and idempotency keys. Both stores
+// take the same locks, so their writers are serialized within one database.
+const (
+	StreamLockQuery    = "SELECT pg_advisory_xact_lock(hashtext($1 || '/' || $2 || '/' || $3))"
+	TryStreamLockQuery = "SELECT pg_try_advisory_xact_lock(hashtext($1 || '/' || $2 || '/' || $3))"
+	KeyLockQuery       = "SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))"
+)
+
+// ParentIndexQuery selects index of the partitioned table the partition
+// index $1 is attached to, $2 is the partitioned table.
+const ParentIndexQuery = "SELECT p.relname FROM pg_inherits i" +
+	" JOIN pg_class c ON c.oid = i.inhrelid JOIN pg_class p ON p.oid = i.inhparent" +
+	" WHERE c.relname = $1 AND c.relnamespace = (SELECT relnamespace FROM pg_class WHERE oid = $2::regclass)"
+
+// Source returns table events are read from. With archive events are read
+// from both event and archive tables.
+func Source(table Table, archive bool) string {
+	if !archive {
+		return table.String()
+	}
+	return "(SELECT * FROM " + table.String() + " UNION ALL SELECT * FROM " + table.Archive().String() + ") AS events"
+}
+
+// TruncationExpr returns expression which hides events of the stream
+// truncated before its truncation point. Tenant, aggregate id and type are
+// placeholders of query arguments.
+func TruncationExpr(table Table, c Columns, tenantId, aggregateId, aggregateType string) string {
+	return c.Version + " >= COALESCE((SELECT truncate_before FROM " + table.Streams().String() +
+		" WHERE tenant_id = " + tenantId +
+		" AND aggregate_id = " + aggregateId +
+		" AND aggregate_type = " + aggregateType + "), 0)"
+}
+
+// TruncateQuery upserts truncation point $4 of the stream ($1 tenant, $2
+// aggregate id, $3 aggregate type). The truncation point moves forward only.
+func TruncateQuery(table Table) string {
+	return "INSERT INTO " + table.Streams().String() + " AS s (tenant_id, aggregate_id, aggregate_type, truncate_before) VALUES ($1, $2, $3, $4)" +
+		" ON CONFLICT (tenant_id, aggregate_id, aggregate_type) DO UPDATE SET truncate_before = GREATEST(s.truncate_before, EXCLUDED.truncate_before)"
+}
+
+// TruncationPointQuery selects truncation point of the stream ($1 tenant,
+// $2 aggregate id, $3 aggregate type).
+func TruncationPointQuery(table Table) string {
+	return "SELECT truncate_before FROM " + table.Streams().String() + " WHERE tenant_id = $1 AND aggregate_id = $2 AND aggregate_type = $3"
+}
+
+// DeleteTruncationQuery deletes truncation point of the stream ($1 tenant,
+// $2 aggregate id, $3 aggregate type).
+func DeleteTruncationQuery(table Table) string {
+	return "DELETE FROM " + table.Streams().String() + " WHERE tenant_id = $1 AND aggregate_id = $2 AND aggregate_type = $3"
+}
+
+// ArchiveQuery moves events of the stream ($1 tenant, $2 aggregate id, $3
+// aggregate type) into the archive table.
+func ArchiveQuery(table Table, c Columns) string {
+	return "WITH archived AS (DELETE FROM " + table.String() +
+		" WHERE " + c.TenantId + " = $1 AND " + c.AggregateId + " = $2 AND " + c.AggregateType + " = $3 RETURNING *)" +
+		" INSERT INTO " + table.Archive().String() + " SELECT * FROM archived"
+}
+
+// ScavengeQuery deletes at most $1 truncated events, the newest event of
+// the stream is always kept. With archive events are moved into the archive
+// table instead. Deleted rows are locked with SKIP LOCKED, concurrent
+// scavengers never wait for each other. Row ctid is unique within a single
+// partition only, so it's paired with tableoid.
+func ScavengeQuery(table Table, c Columns, archive bool) string {
+	q := "DELETE FROM " + table.String() + " WHERE (tableoid, ctid) IN (" +
+		"SELECT e.tableoid, e.ctid FROM " + table.String() + " e JOIN " + table.Streams().String() + " s" +
+		" ON e." + c.TenantId + " = s.tenant_id AND e." + c.AggregateId + " = s.aggregate_id AND e." + c.AggregateType + " = s.aggregate_type" +
+		" WHERE e." + c.Version + " < s.truncate_before AND EXISTS (" +
+		"SELECT 1 FROM " + table.String() + " n WHERE n." + c.TenantId + " = e." + c.TenantId + " AND n." + c.AggregateId + " = e." + c.AggregateId +
+		" AND n." + c.AggregateType + " = e." + c.AggregateType + " AND n." + c.Version + " > e." + c.Version + ")" +
+		" LIMIT $1 FOR UPDATE OF e SKIP LOCKED)"
+	if archive {
+		q = "WITH scavenged AS (" + q + " RETURNING *) INSERT INTO " + table.Archive().String() + " SELECT * FROM scavenged"
+	}
+	return q
+}
+
+// RetentionRule limits how long events of the aggregate type are kept. Zero
+// MaxAge or MaxCount means no limit. The last event of the stream is always
+// kept, so appends continue the stream version. Rule with AggregateId applies
+// to the stream only and overrides rules of its aggregate type, stream rule
+// without limits keeps events of the stream forever.
+type RetentionRule struct {
+	AggregateType string
+	AggregateId   string
+	MaxAge        time.Duration
+	MaxCount      int
+}
+
+// Retention describes events of the stream removed by retention rules.
+type Retention struct {
+	TenantId       string
+	AggregateId    string
+	AggregateType  string
+	TruncateBefore event.Version
+	Removed        int64
+}
+
+// RetentionArgs returns arguments of RetentionQuery: aggregate types,
+// aggregate ids, max ages in microseconds and max counts of the rules. Type
+// rules without limits are skipped, no types means nothing to plan.
+func RetentionArgs(rules []RetentionRule) (types, ids []string, maxAges, maxCounts []int64) {
+	for _, rule := range rules {
+		if rule.AggregateId == "" && rule.MaxAge == 0 && rule.MaxCount == 0 {
+			continue
+		}
+		types = append(types, rule.AggregateType)
+		ids = append(ids, rule.AggregateId)
+		maxAges = append(maxAges, rule.MaxAge.Microseconds())
+		maxCounts = append(maxCounts, int64(rule.MaxCount))
+	}
+	return types, ids, maxAges, maxCounts
+}
+
+// RetentionQuery plans retentions of all rules with a single scan of the
+// event table. Arguments are RetentionArgs and the current time $5, every
+// selected row is scanned into tenant id, aggregate id, aggregate type,
+// truncation point and number of removed events. Every rule is planned
+// separately, type rules skip streams having rules of their own, events
+// already hidden by truncation are not counted, the newest event (rn = 1)
+// is always kept.
+func RetentionQuery(table Table, c Columns) string {
+	return "WITH rules AS (" +
+		"SELECT ord, aggregate_type, aggregate_id, max_count," +
+		" CASE WHEN max_age > 0 THEN $5::TIMESTAMPTZ - max_age * INTERVAL '1 microsecond' END AS cutoff" +
+		" FROM unnest($1::TEXT[], $2::TEXT[], $3::BIGINT[], $4::BIGINT[]) WITH ORDINALITY AS r(aggregate_type, aggregate_id, max_age, max_count, ord)" +
+		"), ranked AS (" +
+		"SELECT r.ord, r.cutoff, r.max_count," +
+		" e." + c.TenantId + " AS tenant_id, e." + c.AggregateId + " AS aggregate_id, e." + c.AggregateType + " AS aggregate_type," +
+		" e." + c.Version + " AS version, e." + c.Timestamp + " AS tstamp," +
+		" ROW_NUMBER() OVER (PARTITION BY r.ord, e." + c.TenantId + ", e." + c.AggregateId + ", e." + c.AggregateType + " ORDER BY e." + c.Version + " DESC) AS rn" +
+		" FROM " + table.String() + " e JOIN rules r ON e." + c.AggregateType + " = r.aggregate_type" +
+		" AND (r.aggregate_id = e." + c.AggregateId + " OR r.aggregate_id = '' AND NOT EXISTS (" +
+		"SELECT 1 FROM rules o WHERE o.aggregate_type = r.aggregate_type AND o.aggregate_id = e." + c.AggregateId + "))" +
+		" LEFT JOIN " + table.Streams().String() + " s" +
+		" ON e." + c.TenantId + " = s.tenant_id AND e." + c.AggregateId + " = s.aggregate_id AND e." + c.AggregateType + " = s.aggregate_type" +
+		" WHERE e." + c.Version + " >= COALESCE(s.truncate_before, 0)" +
+		"), kept AS (" +
+		"SELECT ord, tenant_id, aggregate_id, aggregate_type," +
+		" MIN(version) FILTER (WHERE rn = 1 OR ((cutoff IS NULL OR tstamp >= cutoff) AND (max_count = 0 OR rn <= max_count))) AS keep_from" +
+		" FROM ranked GROUP BY ord, tenant_id, aggregate_id, aggregate_type" +
+		")" +
+		" SELECT k.tenant_id, k.aggregate_id, k.aggregate_type, k.keep_from," +
+		" (SELECT COUNT(*) FROM ranked r WHERE r.ord = k.ord AND r.tenant_id = k.tenant_id AND r.aggregate_id = k.aggregate_id" +
+		" AND r.aggregate_type = k.aggregate_type AND r.version < k.keep_from) AS removed" +
+		" FROM kept k ORDER BY k.ord, k.tenant_id, k.aggregate_id"
+}
+
+// LockPartitionsQuery serializes partitioners of the time partitioned
+// table, appends are not blocked.
+func LockPartitionsQuery(table Table) string {
+	return "LOCK TABLE " + table.String() + " IN SHARE UPDATE EXCLUSIVE MODE"
+}
+
+// PartitionExistsQuery reports whether the partition $1 and the default
+// partition $2 exist.
+const PartitionExistsQuery = "SELECT to_regclass($1) IS NOT NULL, to_regclass($2) IS NOT NULL"
+
+// PartitionMigrations create the partition of the month as a standalone
+// table, move events of the month out of the default partition, if it
+// exists, and attach the partition. PostgreSQL can't attach a partition
+// overlapping rows of the default one. Saves into the default partition
+// wait until events are moved.
+func PartitionMigrations(table Table, c Columns, month time.Time, defaulted bool) []string {
+	partition := table.MonthPartition(month)
+	stmts := []string{"CREATE TABLE " + partition.String() + " (LIKE " + table.String() + " INCLUDING DEFAULTS INCLUDING CONSTRAINTS)"}
+	if defaulted {
+		from, to := QuoteLiteral(month.Format(time.RFC3339)), QuoteLiteral(month.AddDate(0, 1, 0).Format(time.RFC3339))
+		stmts = append(stmts,
+			"LOCK TABLE "+table.DefaultPartition().String()+" IN ACCESS EXCLUSIVE MODE",
+			"WITH moved AS (DELETE FROM "+table.DefaultPartition().String()+" WHERE "+c.Timestamp+" >= "+from+" AND "+c.Timestamp+" < "+to+" RETURNING *)"+
+				" INSERT INTO "+partition.String()+" SELECT * FROM moved",
+		)
+	}
+	return append(stmts, "ALTER TABLE "+table.String()+" ATTACH PARTITION "+partition.String()+" FOR VALUES "+MonthBounds(month))
+}
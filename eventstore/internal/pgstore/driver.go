@@ -0,0 +1,64 @@
+package pgstore
+
+import (
+	"context"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// DB is the connection pool of the driver.
+type DB interface {
+	Querier
+	// Begin begins transaction, read-only if readOnly is true.
+	Begin(ctx context.Context, readOnly bool) (Tx, error)
+}
+
+// Querier is implemented by both DB and Tx.
+type Querier interface {
+	Exec(ctx context.Context, query string, args ...interface{}) (rowsAffected int64, err error)
+	Query(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	// QueryRow returns the row, its Scan fails with sql.ErrNoRows if query
+	// selected nothing.
+	QueryRow(ctx context.Context, query string, args ...interface{}) Row
+}
+
+// Tx is the transaction of the driver. Rollback of the finished transaction
+// fails with sql.ErrTxDone.
+type Tx interface {
+	Querier
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// Copier is implemented by transactions which insert batches of events with
+// COPY. Rows hold values of pgschema.Columns.WriteColumns.
+type Copier interface {
+	CopyFrom(ctx context.Context, table pgschema.Table, rows [][]interface{}) error
+}
+
+type Rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close()
+}
+
+type Row interface {
+	Scan(dest ...interface{}) error
+}
+
+// Driver describes values and errors of the driver.
+type Driver interface {
+	// Array returns parameter of the slice, e.g. of []string.
+	Array(v interface{}) interface{}
+	// ErrorCode returns SQLSTATE and constraint name of the database error,
+	// code is empty if err isn't returned by the database.
+	ErrorCode(err error) (code, constraint string)
+}
+
+const (
+	// uniqueViolation is SQLSTATE of unique index violation.
+	uniqueViolation = "23505"
+	// lockNotAvailable is SQLSTATE of lock_timeout expiration.
+	lockNotAvailable = "55P03"
+)
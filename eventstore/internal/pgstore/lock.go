@@ -0,0 +1,255 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+type lockedStream struct {
+	tenantId      string
+	aggregateId   string
+	aggregateType string
+}
+
+func (s lockedStream) less(other lockedStream) bool {
+	if s.aggregateType != other.aggregateType {
+		return s.aggregateType < other.aggregateType
+	}
+	return s.aggregateId < other.aggregateId
+}
+
+// streamOf returns the stream of the context tenant.
+func streamOf(ctx context.Context, aggregateID, aggregateType string) lockedStream {
+	return lockedStream{
+		tenantId:      eventstore.TenantFromContext(ctx),
+		aggregateId:   aggregateID,
+		aggregateType: aggregateType,
+	}
+}
+
+// lockStreams serializes appends to streams until the end of transaction.
+// Partitioned tables can't keep idempotency keys unique per tenant, so keys
+// of the saved events are locked after streams, in the sorted order, and
+// checked under the lock.
+func (s *Store) lockStreams(ctx context.Context, tx Tx, streams [][]event.Eventer) error {
+	tenantId := eventstore.TenantFromContext(ctx)
+
+	locked := make([]lockedStream, 0, len(streams))
+	for _, events := range streams {
+		if len(events) == 0 {
+			continue
+		}
+		locked = append(locked, lockedStream{
+			tenantId:      tenantId,
+			aggregateId:   events[0].GetAggregateId(),
+			aggregateType: events[0].GetAggregateType(),
+		})
+	}
+	if err := s.lockSorted(ctx, tx, locked...); err != nil {
+		return err
+	}
+
+	if s.TimePartitions || s.HashPartitions {
+		var keys []string
+		for _, events := range streams {
+			keys = append(keys, eventstore.IdempotencyKeys(events)...)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			err := s.advisoryLock(ctx, tx, pgschema.KeyLockQuery, []interface{}{tenantId, key},
+				"idempotency key lock timeout", slog.String("tenant_id", tenantId), slog.String("idempotency_key", key))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lockSorted locks streams in the sorted order, so transactions writing the
+// same streams never deadlock. Streams are locked only if the repository
+// serializes writers (WithAdvisoryLocks or WithTimePartitions). Under the
+// lock of Lock, streams sorted before the held one are not waited for, they
+// fail with ErrLockTimeout if already locked.
+func (s *Store) lockSorted(ctx context.Context, tx Tx, streams ...lockedStream) error {
+	if !s.AdvisoryLocks && !s.TimePartitions {
+		return nil
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].less(streams[j])
+	})
+
+	held, err := s.lockFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		var err error
+		switch {
+		case held != nil && stream == held.stream:
+			continue
+		case held != nil && stream.less(held.stream):
+			err = s.tryLockStream(ctx, tx, stream)
+		default:
+			err = s.lockStream(ctx, tx, stream)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tryLockStream locks the stream if it's not locked by others, otherwise
+// fails with ErrLockTimeout immediately.
+func (s *Store) tryLockStream(ctx context.Context, tx Tx, stream lockedStream) error {
+	var locked bool
+	err := tx.QueryRow(ctx, pgschema.TryStreamLockQuery,
+		stream.tenantId, stream.aggregateId, stream.aggregateType).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		s.Logger.LogAttrs(ctx, slog.LevelWarn, "stream lock out of order",
+			slog.String("tenant_id", stream.tenantId), slog.String("aggregate_id", stream.aggregateId), slog.String("aggregate_type", stream.aggregateType))
+		return eventstore.ErrLockTimeout
+	}
+	return nil
+}
+
+// lockStream serializes appends to the stream until the end of transaction.
+// Lock waits at most lock timeout and then fails with ErrLockTimeout.
+func (s *Store) lockStream(ctx context.Context, tx Tx, stream lockedStream) error {
+	return s.advisoryLock(ctx, tx, pgschema.StreamLockQuery, []interface{}{stream.tenantId, stream.aggregateId, stream.aggregateType},
+		"stream lock timeout", slog.String("tenant_id", stream.tenantId), slog.String("aggregate_id", stream.aggregateId), slog.String("aggregate_type", stream.aggregateType))
+}
+
+// advisoryLock takes the transaction advisory lock with the query. Lock
+// waits at most lock timeout and then fails with ErrLockTimeout, timeout is
+// logged with the message and attributes.
+func (s *Store) advisoryLock(ctx context.Context, tx Tx, q string, args []interface{}, msg string, attrs ...slog.Attr) error {
+	if s.LockTimeout > 0 {
+		timeout := strconv.FormatInt(s.LockTimeout.Milliseconds(), 10) + "ms"
+		if _, err := tx.Exec(ctx, pgschema.SetLockTimeoutQuery, timeout); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(ctx, q, args...)
+	if code, _ := s.Driver.ErrorCode(err); code == lockNotAvailable {
+		s.Logger.LogAttrs(ctx, slog.LevelWarn, msg, append(attrs, slog.Duration("timeout", s.LockTimeout))...)
+		return eventstore.ErrLockTimeout
+	}
+	return err
+}
+
+// ErrForeignLock is returned when the context holds the stream lock taken
+// by another repository, its transaction isn't used by the repository.
+var ErrForeignLock = errors.New("stream lock belongs to another repository")
+
+// StreamLock holds the advisory lock of the stream, see Lock.
+type StreamLock struct {
+	tx     Tx
+	store  *Store
+	stream lockedStream
+	// committed are called once events saved under the lock are committed.
+	committed []func()
+}
+
+// Commit commits events saved under the lock and releases the lock.
+func (l *StreamLock) Commit(ctx context.Context) error {
+	if err := l.tx.Commit(ctx); err != nil {
+		return err
+	}
+	for _, fn := range l.committed {
+		fn()
+	}
+	return nil
+}
+
+// Release discards events saved under the lock and releases the lock, it's
+// no-op after Commit.
+func (l *StreamLock) Release(ctx context.Context) error {
+	err := l.tx.Rollback(ctx)
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+type streamLockKey struct{}
+
+// Lock begins transaction which holds the advisory lock of the stream. Reads
+// and saves with the returned context are performed in the transaction, so
+// the caller can load aggregate, apply events and save them without
+// conflicting with other writers. Writers of the repository created
+// WithAdvisoryLocks option wait for the lock and then fail with
+// ErrControlConcurrency if they saved stale versions, others fail on save
+// as usual. Other streams saved under the lock are locked as well, streams
+// sorted before the locked one fail with ErrLockTimeout if already locked.
+func (s *Store) Lock(ctx context.Context, aggregateID, aggregateType string) (context.Context, *StreamLock, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	stream := streamOf(ctx, aggregateID, aggregateType)
+	if err := s.lockStream(ctx, tx, stream); err != nil {
+		tx.Rollback(ctx)
+		return nil, nil, err
+	}
+
+	lock := &StreamLock{tx: tx, store: s, stream: stream}
+	return context.WithValue(ctx, streamLockKey{}, lock), lock, nil
+}
+
+// lockFromContext returns the stream lock held by the context or nil. Locks
+// taken by other repositories fail with ErrForeignLock, even on the same
+// database.
+func (s *Store) lockFromContext(ctx context.Context) (*StreamLock, error) {
+	lock, _ := ctx.Value(streamLockKey{}).(*StreamLock)
+	if lock == nil {
+		return nil, nil
+	}
+	if lock.store != s {
+		return nil, ErrForeignLock
+	}
+	return lock, nil
+}
+
+// afterCommit calls fn once the write transaction is committed. Saves under
+// the stream lock are committed by the lock holder.
+func (s *Store) afterCommit(ctx context.Context, fn func()) {
+	// Foreign locks already failed writeTx
+	if lock, _ := s.lockFromContext(ctx); lock != nil {
+		lock.committed = append(lock.committed, fn)
+		return
+	}
+	fn()
+}
+
+// writeTx returns transaction for saves. Saves with the context of Lock are
+// performed in the lock transaction, it's committed by the lock holder.
+func (s *Store) writeTx(ctx context.Context) (tx Tx, commit func() error, rollback func(), err error) {
+	lock, err := s.lockFromContext(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if lock != nil {
+		return lock.tx, func() error { return nil }, func() {}, nil
+	}
+
+	tx, err = s.begin(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tx, func() error { return tx.Commit(ctx) }, func() { tx.Rollback(ctx) }, nil
+}
@@ -0,0 +1,90 @@
+package pgstore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// Partitioner creates monthly partitions of the event table partitioned by
+// time (see TimePartitionMigrations). Events out of created partitions go to
+// the DEFAULT partition, so partitions are created ahead of time.
+type Partitioner struct {
+	store *Store
+	ahead int
+}
+
+// NewPartitioner returns partitioner which keeps partitions for the current
+// month and the given number of months ahead.
+func NewPartitioner(store *Store, ahead int) *Partitioner {
+	return &Partitioner{store: store, ahead: ahead}
+}
+
+// EnsurePartitions creates missing partitions. Events of the month saved into
+// the DEFAULT partition before its partition is created are moved into it,
+// PostgreSQL can't attach a partition overlapping rows of the default one.
+func (p *Partitioner) EnsurePartitions(ctx context.Context) error {
+	table, err := p.store.table(ctx)
+	if err != nil {
+		return err
+	}
+
+	month := pgschema.MonthStart(time.Now())
+	for i := 0; i <= p.ahead; i++ {
+		if err := p.ensurePartition(ctx, table, month.AddDate(0, i, 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensurePartition creates the partition of the month as a standalone table,
+// moves events of the month out of the default partition and attaches it.
+func (p *Partitioner) ensurePartition(ctx context.Context, table pgschema.Table, month time.Time) error {
+	// Partitions are accessed directly, row level security of the event
+	// table doesn't hide events of other tenants from the move
+	tx, err := p.store.DB.Begin(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Partitioners of the same table are serialized, appends are not blocked
+	if _, err := tx.Exec(ctx, pgschema.LockPartitionsQuery(table)); err != nil {
+		return err
+	}
+
+	var exists, defaulted bool
+	err = tx.QueryRow(ctx, pgschema.PartitionExistsQuery, table.MonthPartition(month).String(), table.DefaultPartition().String()).Scan(&exists, &defaulted)
+	if err != nil || exists {
+		return err
+	}
+
+	for _, stmt := range pgschema.PartitionMigrations(table, p.store.Columns, month, defaulted) {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// Run ensures partitions every interval until context is done. Failed runs
+// are logged and retried on the next tick.
+func (p *Partitioner) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.EnsurePartitions(ctx); err != nil && ctx.Err() == nil {
+			p.store.Logger.LogAttrs(ctx, slog.LevelError, "partitioning failed", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
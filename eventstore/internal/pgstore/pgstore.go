@@ -0,0 +1,851 @@
+// Package pgstore implements the PostgreSQL event store shared by the
+// postgresql and pgxstore stores. Stores differ only in the driver, which
+// is adapted to DB, Tx and Driver interfaces.
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+	"github.com/0x9ef/eventsourcing-go/internal/logging"
+)
+
+// Store is the event repository, stores set its fields with their options.
+type Store struct {
+	Table   pgschema.Table
+	DB      DB
+	Replica DB
+	Driver  Driver
+	// table layout.
+	Columns     pgschema.Columns
+	PayloadType pgschema.PayloadType
+	// signatures.
+	Signer           event.Signer
+	Verifier         event.SignatureVerifier
+	StrictSignatures bool
+	// tenancy.
+	TenantTable      func(tenantId string) string
+	RowLevelSecurity bool
+	// archival.
+	Archival       bool
+	Truncation     bool
+	TimePartitions bool
+	HashPartitions bool
+	// locking.
+	AdvisoryLocks bool
+	LockTimeout   time.Duration
+	// Saved is called in the transaction of the save once events of the
+	// stream are inserted, e.g. to publish notification.
+	Saved func(ctx context.Context, tx Tx, events []event.Eventer) error
+	// logging.
+	Logger *slog.Logger
+}
+
+// New returns store of the event table described by config.
+func New(db DB, driver Driver, cfg pgschema.Config) *Store {
+	cfg = cfg.WithDefaults()
+	return &Store{
+		Table:       cfg.EventTable(),
+		DB:          db,
+		Driver:      driver,
+		Columns:     cfg.Columns.Quoted(),
+		PayloadType: cfg.PayloadType,
+		Logger:      logging.Discard(),
+	}
+}
+
+// table returns the table with events of the context tenant. Table names
+// returned by the tenant router are validated, see WithTenantTables.
+func (s *Store) table(ctx context.Context) (pgschema.Table, error) {
+	if s.TenantTable != nil {
+		return pgschema.ParseTable(s.TenantTable(eventstore.TenantFromContext(ctx)))
+	}
+	return s.Table, nil
+}
+
+// source returns table events are read from. If archive is enabled events
+// are read from both event and archive tables.
+func (s *Store) source(table pgschema.Table) string {
+	return pgschema.Source(table, s.Archival)
+}
+
+// reader returns querier for read paths on the connection pool. In row level
+// security mode reads are performed in a read-only transaction scoped to the
+// context tenant.
+func (s *Store) reader(ctx context.Context, db DB) (Querier, func(), error) {
+	// Reads under the stream lock see events saved under it
+	lock, err := s.lockFromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lock != nil {
+		return lock.tx, func() {}, nil
+	}
+	if !s.RowLevelSecurity {
+		return db, func() {}, nil
+	}
+
+	tx, err := s.beginOn(ctx, db, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, func() { tx.Rollback(ctx) }, nil
+}
+
+// readDB returns connection pool for reads of the stream. Reads are served
+// by the replica, unless the stream was saved with the version token of the
+// context, since replica may lag behind such writes.
+func (s *Store) readDB(ctx context.Context, aggregateID, aggregateType string) DB {
+	if s.Replica == nil {
+		return s.DB
+	}
+	if token := eventstore.VersionTokenFromContext(ctx); token != nil {
+		if token.Version(eventstore.TenantFromContext(ctx), aggregateID, aggregateType) != event.EmptyVersion {
+			return s.DB
+		}
+	}
+	return s.Replica
+}
+
+// begin begins transaction on the primary, in row level security mode the
+// transaction is scoped to the context tenant.
+func (s *Store) begin(ctx context.Context) (Tx, error) {
+	return s.beginOn(ctx, s.DB, false)
+}
+
+func (s *Store) beginOn(ctx context.Context, db DB, readOnly bool) (Tx, error) {
+	tx, err := db.Begin(ctx, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	if s.RowLevelSecurity {
+		if _, err := tx.Exec(ctx, pgschema.SetTenantQuery, eventstore.TenantFromContext(ctx)); err != nil {
+			tx.Rollback(ctx)
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// scanEvent scans the event selected with ReadColumns.
+func scanEvent(row Row) (*event.Event, error) {
+	var (
+		evtTenantId      string
+		evtAggregateId   string
+		evtAggregateType string
+		evtReason        string
+		evtVersion       int16
+		evtTimestamp     time.Time
+		evtPayload       []byte // nullable
+		evtSerializer    string
+		evtHash          []byte // nullable
+		evtPrevHash      []byte // nullable
+		evtMetadata      []byte // nullable
+		evtSignature     []byte // nullable
+		evtSignatureKey  sql.NullString
+	)
+
+	err := row.Scan(
+		&evtTenantId,
+		&evtAggregateId,
+		&evtAggregateType,
+		&evtReason,
+		&evtVersion,
+		&evtTimestamp,
+		&evtPayload,
+		&evtSerializer,
+		&evtHash,
+		&evtPrevHash,
+		&evtMetadata,
+		&evtSignature,
+		&evtSignatureKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata event.Metadata
+	if evtMetadata != nil {
+		if err := json.Unmarshal(evtMetadata, &metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	evt := new(event.Event)
+	evt.SetTenantId(evtTenantId)
+	evt.SetAggregateId(evtAggregateId)
+	evt.SetAggregateType(evtAggregateType)
+	evt.SetReason(evtReason)
+	evt.SetVersion(event.Version(evtVersion))
+	evt.SetTimestamp(event.Timestamp(evtTimestamp))
+	evt.SetPayload(evtPayload)
+	evt.SetSerializer(event.SerializerType(evtSerializer))
+	evt.SetHash(evtHash)
+	evt.SetPrevHash(evtPrevHash)
+	evt.SetMetadata(metadata)
+	evt.SetSignature(event.Signature{KeyId: evtSignatureKey.String, Value: evtSignature})
+
+	return evt, nil
+}
+
+// eventValues returns values of the event in the order of WriteColumns.
+func (s *Store) eventValues(evt event.Eventer) ([]interface{}, error) {
+	var metadata interface{} // NULL for events without metadata
+	if len(evt.GetMetadata()) != 0 {
+		data, err := json.Marshal(evt.GetMetadata())
+		if err != nil {
+			return nil, err
+		}
+		metadata = string(data)
+	}
+
+	return []interface{}{
+		evt.GetTenantId(),
+		evt.GetAggregateId(),
+		evt.GetAggregateType(),
+		evt.GetReason(),
+		int16(evt.GetVersion()),
+		time.Time(evt.GetTimestamp()),
+		s.payloadValue(evt),
+		string(evt.GetSerializer()),
+		sql.NullString{
+			String: evt.GetIdempotencyKey(),
+			Valid:  evt.GetIdempotencyKey() != "",
+		},
+		[]byte(evt.GetHash()),
+		[]byte(evt.GetPrevHash()),
+		metadata,
+		evt.GetSignature().Value,
+		sql.NullString{
+			String: evt.GetSignature().KeyId,
+			Valid:  evt.GetSignature().KeyId != "",
+		},
+	}, nil
+}
+
+// payloadValue returns payload column value of the event, JSONB payloads
+// are sent as text.
+func (s *Store) payloadValue(evt event.Eventer) interface{} {
+	if s.PayloadType != pgschema.PayloadJSONB {
+		return []byte(evt.GetPayload())
+	}
+	if len(evt.GetPayload()) == 0 {
+		return nil
+	}
+	return string(evt.GetPayload())
+}
+
+// verify verifies signature of the read event if verifier is configured.
+func (s *Store) verify(ctx context.Context, evt event.Eventer) error {
+	if s.Verifier == nil {
+		return nil
+	}
+	if err := event.VerifySignature(evt, s.Verifier, s.StrictSignatures); err != nil {
+		s.Logger.LogAttrs(ctx, slog.LevelError, "event signature verification failed",
+			append(logging.StreamAttrs(evt.GetTenantId(), evt.GetAggregateId(), evt.GetAggregateType(), evt.GetVersion()), slog.Any("error", err))...)
+		return err
+	}
+	return nil
+}
+
+// recordSaved records versions of events saved into the stream into the
+// version token and logs them, it's called once the events are committed.
+// Replica may lag behind the recorded versions only after the commit.
+func (s *Store) recordSaved(ctx context.Context, events []event.Eventer) {
+	s.afterCommit(ctx, func() {
+		eventstore.RecordVersions(ctx, events)
+		s.Logger.LogAttrs(ctx, slog.LevelDebug, "events saved", logging.EventsAttrs(events)...)
+	})
+}
+
+// Get returns the event of the stream with the version. Event timestamp is
+// unknown, so Get probes every partition of the time partitioned table.
+// Missing event is reported with eventstore.ErrEventNotFound, earlier
+// releases of the postgresql store returned sql.ErrNoRows.
+func (s *Store) Get(ctx context.Context, aggregateID, aggregateType string, version event.Version) (event.Eventer, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlbuilder.PostgreSQL.
+		NewSelectBuilder().
+		Select(s.Columns.ReadColumns()...).
+		From(s.source(table))
+
+	sb = sb.Where(
+		sb.Equal(s.Columns.TenantId, eventstore.TenantFromContext(ctx)),
+		sb.And(
+			sb.Equal(s.Columns.AggregateId, aggregateID),
+			sb.Equal(s.Columns.AggregateType, aggregateType),
+			sb.Equal(s.Columns.Version, int16(version)),
+		),
+	)
+	if s.Truncation {
+		sb = sb.Where(s.truncationExpr(ctx, table, sb, aggregateID, aggregateType))
+	}
+
+	q, args := sb.Build()
+
+	db, done, err := s.reader(ctx, s.readDB(ctx, aggregateID, aggregateType))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	evt, err := scanEvent(db.QueryRow(ctx, q, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, eventstore.ErrEventNotFound
+		}
+		return nil, err
+	}
+	if err := s.verify(ctx, evt); err != nil {
+		return nil, err
+	}
+	if err := event.DecryptEvent(evt); err != nil {
+		return nil, err
+	}
+
+	return evt, nil
+}
+
+func (s *Store) List(ctx context.Context, aggregateID, aggregateType string, filter *eventstore.ListFilter) ([]event.Eventer, error) {
+	events, err := s.list(ctx, aggregateID, aggregateType, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := eventstore.DecryptPayloads(events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// list returns events of the stream as they are stored, payloads are not
+// decrypted, so hash chain of the stream can be verified.
+func (s *Store) list(ctx context.Context, aggregateID, aggregateType string, filter *eventstore.ListFilter) ([]event.Eventer, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlbuilder.PostgreSQL.
+		NewSelectBuilder().
+		Select(s.Columns.ReadColumns()...).
+		From(s.source(table))
+
+	var whereExpr []string
+	whereExpr = append(whereExpr, sb.Equal(s.Columns.TenantId, eventstore.TenantFromContext(ctx)))
+	whereExpr = append(whereExpr, sb.And(sb.Equal(s.Columns.AggregateId, aggregateID)))
+	whereExpr = append(whereExpr, sb.And(sb.Equal(s.Columns.AggregateType, aggregateType)))
+	if filter != nil && filter.BeforeVersion > 0 {
+		whereExpr = append(whereExpr, sb.And(sb.LessThan(s.Columns.Version, int16(filter.BeforeVersion))))
+	}
+	if filter != nil && filter.AfterVersion > 0 {
+		whereExpr = append(whereExpr, sb.And(sb.GreaterThan(s.Columns.Version, int16(filter.AfterVersion))))
+	}
+	// Timestamp bounds let time partitioned table to prune partitions
+	if filter != nil && !filter.BeforeTime.IsZero() {
+		whereExpr = append(whereExpr, sb.And(sb.LessThan(s.Columns.Timestamp, filter.BeforeTime)))
+	}
+	if filter != nil && !filter.AfterTime.IsZero() {
+		whereExpr = append(whereExpr, sb.And(sb.GreaterEqualThan(s.Columns.Timestamp, filter.AfterTime)))
+	}
+
+	if s.Truncation {
+		whereExpr = append(whereExpr, sb.And(s.truncationExpr(ctx, table, sb, aggregateID, aggregateType)))
+	}
+
+	sb = sb.Where(whereExpr...).OrderBy(s.Columns.Version).Asc()
+	if filter != nil && filter.Limit > 0 {
+		sb = sb.Limit(filter.Limit)
+	}
+
+	q, args := sb.Build()
+
+	db, done, err := s.reader(ctx, s.readDB(ctx, aggregateID, aggregateType))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	rows, err := db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rowsSize = 16 // preallocated buffer
+	if filter != nil && filter.Limit > 0 {
+		rowsSize = filter.Limit
+	}
+	events := make([]event.Eventer, 0, rowsSize)
+	for rows.Next() {
+		evt, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.verify(ctx, evt); err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// truncationExpr returns expression which hides events of the stream
+// truncated with TruncateBefore.
+func (s *Store) truncationExpr(ctx context.Context, table pgschema.Table, sb *sqlbuilder.SelectBuilder, aggregateID, aggregateType string) string {
+	return pgschema.TruncationExpr(table, s.Columns, sb.Var(eventstore.TenantFromContext(ctx)), sb.Var(aggregateID), sb.Var(aggregateType))
+}
+
+// Verify walks the whole stream and checks its hash chain. The chain of
+// the truncated stream is verified from the first not truncated event.
+func (s *Store) Verify(ctx context.Context, aggregateID, aggregateType string) error {
+	events, err := s.list(ctx, aggregateID, aggregateType, nil)
+	if err != nil {
+		return err
+	}
+	if len(events) != 0 && events[0].GetVersion() > event.NextVersion && s.Truncation {
+		truncated, err := s.truncatedBefore(ctx, aggregateID, aggregateType)
+		if err != nil {
+			return err
+		}
+		if events[0].GetVersion() == truncated {
+			return eventstore.VerifyChainFrom(events[0].GetPrevHash(), events)
+		}
+	}
+	return eventstore.VerifyChain(events)
+}
+
+func (s *Store) Save(ctx context.Context, events []event.Eventer) error {
+	_, err := s.SaveIdempotent(ctx, events)
+	return err
+}
+
+// SaveIdempotent saves events deduplicating them by idempotency keys. When
+// all keyed events were already saved nothing is written and replayed is true.
+func (s *Store) SaveIdempotent(ctx context.Context, events []event.Eventer) (replayed bool, err error) {
+	if err := eventstore.ScopeTenant(ctx, events); err != nil {
+		return false, err
+	}
+
+	kept := pgschema.KeepPayloads([][]event.Eventer{events})
+	defer func() {
+		if err != nil {
+			kept.Restore([][]event.Eventer{events})
+		}
+	}()
+
+	tx, commit, rollback, err := s.writeTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer rollback()
+
+	if err := s.lockStreams(ctx, tx, [][]event.Eventer{events}); err != nil {
+		return false, err
+	}
+
+	replayed, err = s.save(ctx, tx, events)
+	if err != nil || replayed {
+		return replayed, err
+	}
+	if err := commit(); err != nil {
+		return false, err
+	}
+
+	s.recordSaved(ctx, events)
+	return false, nil
+}
+
+// SaveMulti saves events of several aggregates in one transaction. Optimistic
+// concurrency is controlled for every aggregate separately, if any of checks
+// fails no events are saved.
+func (s *Store) SaveMulti(ctx context.Context, streams [][]event.Eventer) (err error) {
+	if err := eventstore.ScopeTenantStreams(ctx, streams); err != nil {
+		return err
+	}
+
+	kept := pgschema.KeepPayloads(streams)
+	defer func() {
+		if err != nil {
+			kept.Restore(streams)
+		}
+	}()
+
+	tx, commit, rollback, err := s.writeTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback()
+
+	if err := s.lockStreams(ctx, tx, streams); err != nil {
+		return err
+	}
+
+	saved := make([][]event.Eventer, 0, len(streams))
+	for _, events := range streams {
+		replayed, err := s.save(ctx, tx, events)
+		if err != nil {
+			return err
+		}
+		if !replayed && len(events) != 0 {
+			saved = append(saved, events)
+		}
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+
+	for _, events := range saved {
+		s.recordSaved(ctx, events)
+	}
+	return nil
+}
+
+func (s *Store) save(ctx context.Context, tx Tx, events []event.Eventer) (bool, error) {
+	if len(events) == 0 {
+		return false, nil
+	}
+	if err := eventstore.ValidateStream(events); err != nil {
+		return false, err
+	}
+
+	// Retried requests are not saved twice
+	replayed, err := s.replayed(ctx, tx, events)
+	if err != nil {
+		return false, err
+	}
+	if replayed {
+		// Replayed events are saved, but replica may still lag behind them
+		s.afterCommit(ctx, func() { eventstore.RecordVersions(ctx, events) })
+		s.Logger.LogAttrs(ctx, slog.LevelInfo, "save replayed",
+			logging.StreamAttrs(events[0].GetTenantId(), events[0].GetAggregateId(), events[0].GetAggregateType(), events[0].GetVersion())...)
+		return true, nil
+	}
+
+	tenantId := events[0].GetTenantId()
+	aggregateId := events[0].GetAggregateId()
+	aggregateType := events[0].GetAggregateType()
+	version := events[0].GetVersion()
+
+	// Try to control concurrency
+	prevHash, err := s.controlConcurrency(ctx, tx, tenantId, aggregateId, aggregateType, version)
+	if err != nil {
+		return false, err
+	}
+
+	// Timestamps are saved as they are hashed and signed
+	eventstore.TruncateTimestamps(events)
+
+	// Encrypted payloads are bound to events before they are signed
+	unbind, err := eventstore.BindPayloads(events)
+	if err != nil {
+		return false, err
+	}
+	defer unbind()
+
+	if s.PayloadType == pgschema.PayloadJSONB {
+		if err := s.normalizePayloads(ctx, tx, events); err != nil {
+			return false, err
+		}
+	}
+
+	// Sign events before chaining, so signature covers only event content
+	if s.Signer != nil {
+		for _, evt := range events {
+			if err := event.Sign(evt, s.Signer); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// Chain every event with the previous one
+	eventstore.ChainHashes(prevHash, events)
+
+	table, err := s.table(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// Concurrent saves of the same keys or versions fail on unique indexes.
+	// Savepoint keeps the transaction usable, so keys are checked again and
+	// indexes of partitions are resolved to indexes of the table
+	savepoint := len(eventstore.IdempotencyKeys(events)) != 0 || s.TimePartitions || s.HashPartitions
+	if savepoint {
+		if _, err := tx.Exec(ctx, "SAVEPOINT es_save"); err != nil {
+			return false, err
+		}
+	}
+	if err := s.insert(ctx, tx, table, events); err != nil {
+		return s.insertFailed(ctx, tx, table, events, savepoint, err)
+	}
+	if savepoint {
+		if _, err := tx.Exec(ctx, "RELEASE SAVEPOINT es_save"); err != nil {
+			return false, err
+		}
+	}
+
+	if s.Saved != nil {
+		if err := s.Saved(ctx, tx, events); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// insert inserts events with INSERT statements, batches of events are
+// inserted with COPY if the transaction is Copier.
+func (s *Store) insert(ctx context.Context, tx Tx, table pgschema.Table, events []event.Eventer) error {
+	rows := make([][]interface{}, len(events))
+	for i, evt := range events {
+		values, err := s.eventValues(evt)
+		if err != nil {
+			return err
+		}
+		rows[i] = values
+	}
+
+	if copier, ok := tx.(Copier); ok && len(rows) > 1 {
+		return copier.CopyFrom(ctx, table, rows)
+	}
+
+	for _, values := range rows {
+		ib := sqlbuilder.PostgreSQL.
+			NewInsertBuilder().
+			InsertInto(table.String()).
+			Cols(s.Columns.WriteColumns()...).
+			Values(values...)
+		q, args := ib.Build()
+
+		if _, err := tx.Exec(ctx, q, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertFailed maps unique violations of concurrent saves to
+// ErrIdempotencyConflict and ErrControlConcurrency. Saves of the same keys
+// committed meanwhile are replayed.
+func (s *Store) insertFailed(ctx context.Context, tx Tx, table pgschema.Table, events []event.Eventer, savepoint bool, err error) (bool, error) {
+	code, index := s.Driver.ErrorCode(err)
+	if code != uniqueViolation {
+		return false, err
+	}
+
+	if savepoint {
+		if _, err := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT es_save"); err != nil {
+			return false, err
+		}
+		replayed, err := s.replayed(ctx, tx, events)
+		if err != nil {
+			return false, err
+		}
+		if replayed {
+			s.Logger.LogAttrs(ctx, slog.LevelInfo, "save replayed",
+				logging.StreamAttrs(events[0].GetTenantId(), events[0].GetAggregateId(), events[0].GetAggregateType(), events[0].GetVersion())...)
+			return true, nil
+		}
+		if s.TimePartitions || s.HashPartitions {
+			if index, err = s.parentIndex(ctx, tx, table, index); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(index, pgschema.IdempotencyIndexSuffix):
+		return false, eventstore.ErrIdempotencyConflict
+	case strings.HasSuffix(index, pgschema.VersionIndexSuffix):
+		s.Logger.LogAttrs(ctx, slog.LevelWarn, "concurrency conflict",
+			logging.StreamAttrs(events[0].GetTenantId(), events[0].GetAggregateId(), events[0].GetAggregateType(), events[0].GetVersion())...)
+		return false, &eventstore.ConcurrencyError{
+			AggregateId:   events[0].GetAggregateId(),
+			AggregateType: events[0].GetAggregateType(),
+			Version:       events[0].GetVersion(),
+		}
+	}
+	return false, err
+}
+
+// parentIndex returns index of the partitioned table the partition index
+// is attached to, or the index itself.
+func (s *Store) parentIndex(ctx context.Context, tx Tx, table pgschema.Table, index string) (string, error) {
+	var parent string
+	err := tx.QueryRow(ctx, pgschema.ParentIndexQuery, index, table.String()).Scan(&parent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return index, nil
+	}
+	return parent, err
+}
+
+// replayed reports whether all keyed events were already saved. Keys aren't
+// bound by time, so every partition of the time partitioned table is probed.
+func (s *Store) replayed(ctx context.Context, tx Tx, events []event.Eventer) (bool, error) {
+	keys := eventstore.IdempotencyKeys(events)
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	table, err := s.table(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	args := make([]interface{}, len(keys))
+	for i := range keys {
+		args[i] = keys[i]
+	}
+
+	sb := sqlbuilder.PostgreSQL.
+		NewSelectBuilder().
+		Select("COUNT(*)").
+		From(s.source(table))
+	sb = sb.Where(
+		sb.Equal(s.Columns.TenantId, events[0].GetTenantId()),
+		sb.And(sb.In(s.Columns.IdempotencyKey, args...)),
+	)
+
+	q, qargs := sb.Build()
+
+	var found int
+	if err := tx.QueryRow(ctx, q, qargs...).Scan(&found); err != nil {
+		return false, err
+	}
+
+	switch {
+	case found == 0:
+		return false, nil
+	case found == len(keys):
+		return true, nil
+	}
+	return false, eventstore.ErrIdempotencyConflict
+}
+
+// Optimistic concurrency control
+// https://en.wikipedia.org/wiki/Optimistic_concurrency_control
+//
+// Returns hash of the last event of the stream, the hash chain of saved
+// events continues from it.
+func (s *Store) controlConcurrency(ctx context.Context, tx Tx, tenantId, aggregateId, aggregateType string, version event.Version) (event.Hash, error) {
+	last, err := s.lastEvent(ctx, tx, tenantId, aggregateId, aggregateType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Closed streams accept no events
+	if last.reason == event.ReasonTombstone {
+		s.Logger.LogAttrs(ctx, slog.LevelWarn, "save to deleted stream", logging.StreamAttrs(tenantId, aggregateId, aggregateType, version)...)
+		return nil, &eventstore.StreamDeletedError{
+			AggregateId:   aggregateId,
+			AggregateType: aggregateType,
+			Version:       last.version,
+		}
+	}
+
+	// Check that no other versions are inserted
+	if (last.version + event.NextVersion) != version {
+		s.Logger.LogAttrs(ctx, slog.LevelWarn, "concurrency conflict",
+			append(logging.StreamAttrs(tenantId, aggregateId, aggregateType, version), slog.Int("last_version", int(last.version)))...)
+		return nil, &eventstore.ConcurrencyError{
+			AggregateId:   aggregateId,
+			AggregateType: aggregateType,
+			Version:       version,
+		}
+	}
+
+	return last.hash, nil
+}
+
+type lastEvent struct {
+	version event.Version
+	reason  string
+	hash    event.Hash
+}
+
+// lastEvent returns the last event of the stream, including archived
+// ones. Empty stream has EmptyVersion. The stream isn't bound by time, so
+// every partition of the time partitioned table is probed.
+func (s *Store) lastEvent(ctx context.Context, tx Tx, tenantId, aggregateId, aggregateType string) (lastEvent, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return lastEvent{}, err
+	}
+
+	sb := sqlbuilder.PostgreSQL.
+		NewSelectBuilder().
+		Select(s.Columns.Version, s.Columns.Reason, s.Columns.Hash).
+		From(s.source(table))
+
+	sb = sb.Where(
+		sb.Equal(s.Columns.TenantId, tenantId),
+		sb.And(
+			sb.Equal(s.Columns.AggregateId, aggregateId),
+			sb.Equal(s.Columns.AggregateType, aggregateType),
+		),
+	)
+	sb = sb.
+		OrderBy(s.Columns.Version).
+		Desc().
+		Limit(1)
+
+	q, args := sb.Build()
+
+	var (
+		last        = lastEvent{version: event.EmptyVersion}
+		lastVersion int16
+		lastHash    []byte // nullable
+	)
+	err = tx.QueryRow(ctx, q, args...).Scan(&lastVersion, &last.reason, &lastHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return lastEvent{}, err
+	}
+	if err == nil {
+		last.version = event.Version(lastVersion)
+	}
+	last.hash = lastHash
+
+	return last, nil
+}
+
+// normalizePayloads replaces JSON payloads with their JSONB text
+// representation. JSONB doesn't keep payload text as is, so payloads are
+// normalized before they are signed and chained, otherwise hashes of read
+// events won't match.
+func (s *Store) normalizePayloads(ctx context.Context, tx Tx, events []event.Eventer) error {
+	payloads, indexes, err := pgschema.JSONPayloads(events)
+	if err != nil || len(payloads) == 0 {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, pgschema.NormalizeQuery, s.Driver.Array(payloads))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for n := 0; rows.Next(); n++ {
+		var normalized string
+		if err := rows.Scan(&normalized); err != nil {
+			return err
+		}
+		events[indexes[n]].SetPayload(event.Payload(normalized))
+	}
+	return rows.Err()
+}
@@ -0,0 +1,156 @@
+package pgstore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// Compactor enforces retention rules. Streams are truncated with the
+// retention point and truncated events are deleted by Scavenger, so the
+// repository should be created WithTruncation option. Compactor handles the
+// event table of the context tenant, with WithTenantTables option it should
+// be run for every tenant, see eventstore.WithTenant.
+type Compactor struct {
+	store     *Store
+	rules     []pgschema.RetentionRule
+	scavenger *Scavenger
+}
+
+// NewCompactor returns compactor which deletes truncated events in batches
+// of batchSize, non-positive batch size falls back to 1000.
+func NewCompactor(store *Store, batchSize int, rules ...pgschema.RetentionRule) *Compactor {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &Compactor{store: store, rules: rules, scavenger: NewScavenger(store, batchSize)}
+}
+
+// DryRun reports events which would be removed by retention rules without
+// removing them.
+func (c *Compactor) DryRun(ctx context.Context) ([]pgschema.Retention, error) {
+	if !c.store.Truncation {
+		return nil, eventstore.ErrNotSupported
+	}
+
+	// Report is planned on the primary exactly as Compact plans it
+	db, done, err := c.store.reader(ctx, c.store.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return c.plan(ctx, db, time.Now())
+}
+
+// Compact truncates streams by retention rules, deletes truncated events and
+// returns what has been removed. Truncation points are written under the
+// stream locks, like TruncateBefore does.
+func (c *Compactor) Compact(ctx context.Context) ([]pgschema.Retention, error) {
+	if !c.store.Truncation {
+		return nil, eventstore.ErrNotSupported
+	}
+
+	tx, err := c.store.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	retentions, err := c.plan(ctx, tx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := c.store.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make([]lockedStream, 0, len(retentions))
+	for _, ret := range retentions {
+		streams = append(streams, lockedStream{
+			tenantId:      ret.TenantId,
+			aggregateId:   ret.AggregateId,
+			aggregateType: ret.AggregateType,
+		})
+	}
+	if err := c.store.lockSorted(ctx, tx, streams...); err != nil {
+		return nil, err
+	}
+
+	for _, ret := range retentions {
+		_, err := tx.Exec(ctx, pgschema.TruncateQuery(table),
+			ret.TenantId, ret.AggregateId, ret.AggregateType, int16(ret.TruncateBefore))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.scavenger.Scavenge(ctx); err != nil {
+		return retentions, err
+	}
+	return retentions, nil
+}
+
+// Run compacts streams every interval until context is done. Failed runs
+// are logged and retried on the next tick.
+func (c *Compactor) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Compact(ctx); err != nil && ctx.Err() == nil {
+			c.store.Logger.LogAttrs(ctx, slog.LevelError, "compaction failed", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// plan plans retentions of all rules with a single scan of the event table.
+func (c *Compactor) plan(ctx context.Context, db Querier, now time.Time) ([]pgschema.Retention, error) {
+	types, ids, maxAges, maxCounts := pgschema.RetentionArgs(c.rules)
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	table, err := c.store.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := c.store.Driver
+	rows, err := db.Query(ctx, pgschema.RetentionQuery(table, c.store.Columns), driver.Array(types), driver.Array(ids), driver.Array(maxAges), driver.Array(maxCounts), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var retentions []pgschema.Retention
+	for rows.Next() {
+		var (
+			ret            pgschema.Retention
+			truncateBefore int16
+		)
+		if err := rows.Scan(&ret.TenantId, &ret.AggregateId, &ret.AggregateType, &truncateBefore, &ret.Removed); err != nil {
+			return nil, err
+		}
+		ret.TruncateBefore = event.Version(truncateBefore)
+		if ret.Removed > 0 {
+			retentions = append(retentions, ret)
+		}
+	}
+	return retentions, rows.Err()
+}
@@ -0,0 +1,88 @@
+package pgstore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// Scavenger physically deletes events hidden by TruncateBefore. The newest
+// event of the stream is always kept, so deleted streams keep their
+// tombstones and versions continue from the last one. Events are deleted in
+// small batches, each batch in its own transaction, so appends are never
+// blocked for long. If repository is created WithArchive option,
+// truncated events are moved into the archive table instead. Like Compactor,
+// Scavenger handles the event table of the context tenant.
+type Scavenger struct {
+	store     *Store
+	batchSize int
+}
+
+// defaultBatchSize is used by Scavenger and Compactor created with
+// non-positive batch size.
+const defaultBatchSize = 1000
+
+// NewScavenger returns scavenger which deletes events in batches of
+// batchSize, non-positive batch size falls back to 1000.
+func NewScavenger(store *Store, batchSize int) *Scavenger {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &Scavenger{store: store, batchSize: batchSize}
+}
+
+// Scavenge deletes all truncated events and returns their number.
+func (s *Scavenger) Scavenge(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		n, err := s.scavengeBatch(ctx)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n == 0 || n < int64(s.batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// Run scavenges truncated events every interval until context is done.
+// Failed runs are logged and retried on the next tick.
+func (s *Scavenger) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Scavenge(ctx); err != nil && ctx.Err() == nil {
+			s.store.Logger.LogAttrs(ctx, slog.LevelError, "scavenge failed", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scavenger) scavengeBatch(ctx context.Context) (int64, error) {
+	table, err := s.store.table(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.store.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := tx.Exec(ctx, pgschema.ScavengeQuery(table, s.store.Columns, s.store.Archival), s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit(ctx)
+}
@@ -0,0 +1,190 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// SoftDelete appends tombstone event to the stream. Events are kept, but
+// further appends are rejected with *eventstore.StreamDeletedError.
+func (s *Store) SoftDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	tx, commit, rollback, err := s.writeTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback()
+
+	if err := s.lockSorted(ctx, tx, streamOf(ctx, aggregateID, aggregateType)); err != nil {
+		return err
+	}
+
+	last, err := s.lastEvent(ctx, tx, eventstore.TenantFromContext(ctx), aggregateID, aggregateType)
+	if err != nil {
+		return err
+	}
+	if last.version == event.EmptyVersion {
+		return eventstore.ErrEventNotFound
+	}
+
+	tombstone := event.NewTombstone(aggregateID, aggregateType, last.version+event.NextVersion)
+	tombstone.SetTenantId(eventstore.TenantFromContext(ctx))
+	if _, err := s.save(ctx, tx, []event.Eventer{tombstone}); err != nil {
+		return err
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+
+	s.recordSaved(ctx, []event.Eventer{tombstone})
+	return nil
+}
+
+// HardDelete physically deletes all events of the stream, archived
+// events and the truncation point of the stream are deleted as well.
+func (s *Store) HardDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	table, err := s.table(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, commit, rollback, err := s.writeTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback()
+
+	if err := s.lockSorted(ctx, tx, streamOf(ctx, aggregateID, aggregateType)); err != nil {
+		return err
+	}
+
+	tables := []string{table.String()}
+	if s.Archival {
+		tables = append(tables, table.Archive().String())
+	}
+
+	for _, table := range tables {
+		db := sqlbuilder.PostgreSQL.NewDeleteBuilder().DeleteFrom(table)
+		db = db.Where(
+			db.Equal(s.Columns.TenantId, eventstore.TenantFromContext(ctx)),
+			db.And(
+				db.Equal(s.Columns.AggregateId, aggregateID),
+				db.Equal(s.Columns.AggregateType, aggregateType),
+			),
+		)
+
+		q, args := db.Build()
+		if _, err := tx.Exec(ctx, q, args...); err != nil {
+			return err
+		}
+	}
+
+	// Stream recreated with the same id starts untruncated
+	if s.Truncation {
+		_, err := tx.Exec(ctx, pgschema.DeleteTruncationQuery(table), eventstore.TenantFromContext(ctx), aggregateID, aggregateType)
+		if err != nil {
+			return err
+		}
+	}
+
+	return commit()
+}
+
+// Archive moves all events of the stream into the archive table. Repository
+// should be created WithArchive option.
+func (s *Store) Archive(ctx context.Context, aggregateID, aggregateType string) error {
+	if !s.Archival {
+		return eventstore.ErrNotSupported
+	}
+
+	table, err := s.table(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, commit, rollback, err := s.writeTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback()
+
+	if err := s.lockSorted(ctx, tx, streamOf(ctx, aggregateID, aggregateType)); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, pgschema.ArchiveQuery(table, s.Columns), eventstore.TenantFromContext(ctx), aggregateID, aggregateType)
+	if err != nil {
+		return err
+	}
+
+	return commit()
+}
+
+// TruncateBefore hides events of the stream before the version from all
+// reads. Repository should be created WithTruncation option, truncated events
+// are physically deleted by Scavenger. Version above the last one is clamped
+// to it, so the last event, e.g. the tombstone, is never hidden, and the
+// truncation point never moves backwards.
+func (s *Store) TruncateBefore(ctx context.Context, aggregateID, aggregateType string, version event.Version) error {
+	if !s.Truncation {
+		return eventstore.ErrNotSupported
+	}
+	table, err := s.table(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, commit, rollback, err := s.writeTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback()
+
+	if err := s.lockSorted(ctx, tx, streamOf(ctx, aggregateID, aggregateType)); err != nil {
+		return err
+	}
+
+	last, err := s.lastEvent(ctx, tx, eventstore.TenantFromContext(ctx), aggregateID, aggregateType)
+	if err != nil {
+		return err
+	}
+	if last.version == event.EmptyVersion {
+		return eventstore.ErrEventNotFound
+	}
+	if version > last.version {
+		version = last.version
+	}
+
+	_, err = tx.Exec(ctx, pgschema.TruncateQuery(table), eventstore.TenantFromContext(ctx), aggregateID, aggregateType, int16(version))
+	if err != nil {
+		return err
+	}
+
+	return commit()
+}
+
+func (s *Store) truncatedBefore(ctx context.Context, aggregateID, aggregateType string) (event.Version, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	db, done, err := s.reader(ctx, s.readDB(ctx, aggregateID, aggregateType))
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	var version int16
+	err = db.QueryRow(ctx, pgschema.TruncationPointQuery(table), eventstore.TenantFromContext(ctx), aggregateID, aggregateType).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	return event.Version(version), nil
+}
@@ -0,0 +1,186 @@
+// Package pgtest runs PostgreSQL in Docker for tests of the PostgreSQL
+// stores and holds fixtures shared by them.
+package pgtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+)
+
+// Setup prepares the database for tests.
+type Setup struct {
+	// Connect connects to the database listening on the port, it's retried
+	// until the database accepts connections. Database "test" is accessed
+	// by superuser "root" with password "root".
+	Connect func(port string) error
+	// Migrate creates tables used by tests.
+	Migrate func() error
+}
+
+// Run starts PostgreSQL container, sets up the database, runs tests and
+// exits with their code.
+func Run(m *testing.M, setup Setup) {
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+
+	logger.Print("Initializing pool...")
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("failed to init pool: %s", err)
+	}
+
+	logger.Print("Checking connection to Docker...")
+	if err := pool.Client.Ping(); err != nil {
+		log.Fatalf("failed to check connection to Docker: %s", err)
+	}
+
+	logger.Print("Running resource...")
+	postgres, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "14",
+		Env: []string{
+			"POSTGRES_USER=root",
+			"POSTGRES_PASSWORD=root",
+			"POSTGRES_DB=test",
+			"listen_addresses = '*'",
+		},
+	}, func(config *docker.HostConfig) {
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{
+			Name: "no",
+		}
+	})
+	if err != nil {
+		log.Fatalf("failed to run resource: %s", err)
+	}
+	if err := postgres.Expire(30); err != nil {
+		log.Fatalf("failed to set expire timeout: %s", err)
+	}
+
+	port := postgres.GetPort("5432/tcp")
+	logger.Print("Trying to connect to database...")
+	if err := pool.Retry(func() error {
+		return setup.Connect(port)
+	}); err != nil {
+		log.Fatalf("failed to connect to database: %s", err)
+	}
+
+	logger.Print("Migration SQL statements...")
+	if err := setup.Migrate(); err != nil {
+		log.Fatalf("failed to migrate: %s", err)
+	}
+
+	logger.Print("Running tests...")
+	exitCode := m.Run()
+	if err := pool.Purge(postgres); err != nil {
+		log.Fatalf("failed to purge postgres resource: %s", err)
+	}
+
+	logger.Printf("Exit %d.", exitCode)
+	os.Exit(exitCode)
+}
+
+type TestAggregator struct {
+	*eventsourcing.AggregateCluster
+	Status string
+}
+
+const (
+	ReasonCreated   = "created"
+	ReasonConfirmed = "confirmed"
+)
+
+func (ta *TestAggregator) Transition(evt event.Eventer) error {
+	switch evt.GetReason() {
+	case ReasonCreated:
+		return ta.onCreated(evt)
+	case ReasonConfirmed:
+		return ta.onConfirmed(evt)
+	}
+	return errors.New("undefined event type")
+}
+
+type Created struct {
+	Status string
+}
+
+func (ta *TestAggregator) onCreated(evt event.Eventer) error {
+	var payload Created
+	if err := json.Unmarshal(evt.GetPayload(), &payload); err != nil {
+		return err
+	}
+	ta.Status = payload.Status
+	return nil
+}
+
+type Confirmed struct {
+	Status string
+}
+
+func (ta *TestAggregator) onConfirmed(evt event.Eventer) error {
+	var payload Confirmed
+	if err := json.Unmarshal(evt.GetPayload(), &payload); err != nil {
+		return err
+	}
+	ta.Status = payload.Status
+	return nil
+}
+
+// SeedEvents applies created and confirmed events to the aggregate and saves
+// them.
+func SeedEvents(root *eventsourcing.AggregateCluster, repo eventstore.Repository) ([]*event.Event, error) {
+	events := []*event.Event{
+		event.MustNew(ReasonCreated, Created{Status: "Created"}),
+		event.MustNew(ReasonConfirmed, Confirmed{Status: "Confirmed"}),
+	}
+	for _, evt := range events {
+		err := root.Apply(evt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, repo.Save(context.TODO(), event.Covarience(events))
+}
+
+// RegisterEncryption registers encrypting JSON serializer with the key
+// written into dir.
+func RegisterEncryption(dir string) (event.SerializerType, error) {
+	if err := event.WriteKeyFile(dir, "key_0"); err != nil {
+		return "", err
+	}
+	keys, err := event.NewFileKeyProvider(dir, "key_0")
+	if err != nil {
+		return "", err
+	}
+	return event.RegisterEncryptingSerializer(event.SerializerTypeJSON, keys)
+}
+
+// EncryptedEvents returns created and confirmed events of the aggregate with
+// payloads encoded by the serializer. Events aren't applied, since the
+// aggregate decodes JSON payloads only.
+func EncryptedEvents(root *eventsourcing.AggregateCluster, typ event.SerializerType) ([]event.Eventer, error) {
+	payloads := []interface{}{Created{Status: "Created"}, Confirmed{Status: "Confirmed"}}
+	events := make([]event.Eventer, 0, len(payloads))
+	for i, reason := range []string{ReasonCreated, ReasonConfirmed} {
+		evt, err := event.NewWithSerializer(reason, payloads[i], typ)
+		if err != nil {
+			return nil, err
+		}
+		evt.SetAggregateId(root.GetId())
+		evt.SetAggregateType(root.GetType())
+		evt.SetVersion(event.Version(i + 1))
+		events = append(events, evt)
+	}
+	return events, nil
+}
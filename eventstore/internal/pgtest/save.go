@@ -0,0 +1,554 @@
+package pgtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+func (s *suite) testSave(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	events := []*event.Event{
+		event.MustNew("created", Created{Status: "Created"}),
+		event.MustNew("confirmed", Confirmed{Status: "Confirmed"}),
+	}
+	for _, evt := range events {
+		err := root.Apply(evt)
+		assert.NoError(t, err, "failed to apply")
+	}
+
+	repo := s.repo(t, "es_events", Options{})
+	err := repo.Save(context.TODO(), event.Covarience(events))
+	assert.NoError(t, err, "failed to save events in database")
+}
+
+func (s *suite) testGet(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	evt, err := repo.Get(ctx, events[1].GetAggregateId(), events[1].GetAggregateType(), events[1].GetVersion())
+	assert.NoError(t, err, "failed to get event from database")
+	assert.Equal(t, "TestAggregator", evt.GetAggregateType())
+	assert.Equal(t, "confirmed", evt.GetReason())
+	assert.Equal(t, event.Version(2), evt.GetVersion())
+
+	_, err = repo.Get(ctx, events[1].GetAggregateId(), events[1].GetAggregateType(), 3)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+}
+
+func (s *suite) testList(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	type testCase struct {
+		name   string
+		filter *eventstore.ListFilter
+		// expectations.
+		expectedLen int
+	}
+
+	cases := []testCase{
+		{
+			name:        "positive_all",
+			filter:      nil,
+			expectedLen: 2,
+		},
+		{
+			name:        "positive_before",
+			filter:      &eventstore.ListFilter{BeforeVersion: events[1].GetVersion()},
+			expectedLen: 1,
+		},
+		{
+			name:        "positive_after",
+			filter:      &eventstore.ListFilter{AfterVersion: events[0].GetVersion()},
+			expectedLen: 1,
+		},
+		{
+			name:        "positive_limit_1",
+			filter:      &eventstore.ListFilter{Limit: 1},
+			expectedLen: 1,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), testCase.filter)
+			assert.NoError(t, err, "failed to get list of events")
+			assert.Equal(t, testCase.expectedLen, len(listEvents))
+		})
+	}
+}
+
+func (s *suite) testSaveMulti(t *testing.T) {
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+
+	payment := &TestAggregator{}
+	payment.AggregateCluster = eventsourcing.New(payment, payment.Transition, eventsourcing.NanoidGenerator)
+	ledger := &TestAggregator{}
+	ledger.AggregateCluster = eventsourcing.New(ledger, ledger.Transition, eventsourcing.NanoidGenerator)
+
+	_, err := SeedEvents(ledger.AggregateCluster, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	err = payment.Apply(event.MustNew("created", Created{Status: "Created"}))
+	assert.NoError(t, err, "failed to apply")
+
+	conflicted := event.MustNew("created", Created{Status: "Created"})
+	conflicted.SetAggregateId(ledger.GetId())
+	conflicted.SetAggregateType(ledger.GetType())
+	conflicted.SetVersion(1)
+
+	token := eventstore.NewVersionToken()
+	tokenCtx := eventstore.WithVersionToken(ctx, token)
+	err = repo.SaveMulti(tokenCtx, [][]event.Eventer{payment.ListUncommittedEvents(), {conflicted}})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	assert.Equal(t, event.EmptyVersion, token.Version("", payment.GetId(), payment.GetType()), "versions of rolled back saves must not be recorded")
+
+	events, err := repo.List(ctx, payment.GetId(), payment.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 0, len(events), "no events must be saved on conflict")
+
+	err = repo.SaveMulti(tokenCtx, [][]event.Eventer{payment.ListUncommittedEvents()})
+	assert.NoError(t, err, "failed to save events")
+	assert.Equal(t, event.Version(1), token.Version("", payment.GetId(), payment.GetType()))
+}
+
+func (s *suite) testSaveIdempotent(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+
+	events := []*event.Event{
+		event.MustNew("created", Created{Status: "Created"}),
+		event.MustNew("confirmed", Confirmed{Status: "Confirmed"}),
+	}
+	for _, evt := range events {
+		err := root.Apply(evt)
+		assert.NoError(t, err, "failed to apply")
+	}
+	event.SetBatchIdempotencyKey(event.Covarience(events), root.GetId())
+
+	replayed, err := repo.SaveIdempotent(ctx, event.Covarience(events))
+	assert.NoError(t, err, "failed to save events in database")
+	assert.False(t, replayed)
+
+	// Same batch resubmitted at different versions
+	for _, evt := range events {
+		evt.SetVersion(evt.GetVersion() + 2)
+	}
+	replayed, err = repo.SaveIdempotent(ctx, event.Covarience(events))
+	assert.NoError(t, err, "failed to save events in database")
+	assert.True(t, replayed)
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 2, len(listEvents))
+}
+
+func (s *suite) testSaveIdempotentRace(t *testing.T) {
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+	key := eventsourcing.UUIDGenerator("", 0)
+
+	// The first save is not committed yet, the second one passes the key
+	// check and waits on the unique index
+	tx, err := s.db.BeginTx(ctx, nil)
+	assert.NoError(t, err, "failed to begin")
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "INSERT INTO es_events (aggregate_id, aggregate_type, reason, version, tstamp, idempotency_key) VALUES ($1, 'Payment', 'created', 1, now(), $2)", "first_"+key, key)
+	assert.NoError(t, err, "failed to insert event")
+	var pid int
+	err = tx.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid)
+	assert.NoError(t, err, "failed to get backend pid")
+
+	type result struct {
+		replayed bool
+		err      error
+	}
+	done := make(chan result)
+	go func() {
+		evt := event.MustNew("created", Created{Status: "Created"})
+		evt.SetAggregateId("second_" + key)
+		evt.SetAggregateType("Payment")
+		evt.SetVersion(1)
+		evt.SetIdempotencyKey(key)
+		replayed, err := repo.SaveIdempotent(ctx, []event.Eventer{evt})
+		done <- result{replayed, err}
+	}()
+	s.waitBlocked(t, pid)
+	assert.NoError(t, tx.Commit(), "failed to commit")
+
+	res := <-done
+	assert.NoError(t, res.err, "concurrent save must be replayed")
+	assert.True(t, res.replayed)
+}
+
+func (s *suite) testVerify(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	err = repo.Verify(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "hash chain must be valid")
+
+	_, err = s.db.ExecContext(ctx, "UPDATE es_events SET reason = 'refunded' WHERE aggregate_id = $1 AND version = $2", root.GetId(), events[1].GetVersion())
+	assert.NoError(t, err, "failed to tamper event")
+
+	err = repo.Verify(ctx, root.GetId(), root.GetType())
+	var chainErr *eventstore.ChainError
+	assert.True(t, errors.As(err, &chainErr), "error must be *ChainError")
+	assert.Equal(t, events[1].GetVersion(), chainErr.Version)
+}
+
+func (s *suite) testVerifySubMicrosecondTimestamps(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	// Timestamps with remainder of 500ns and more are rounded up by
+	// PostgreSQL, unless they are truncated on save
+	evt := event.MustNew(ReasonCreated, Created{Status: "Created"})
+	evt.SetTimestamp(event.Timestamp(time.Date(2024, 1, 1, 0, 0, 0, 1700, time.UTC)))
+	assert.NoError(t, root.Apply(evt), "failed to apply")
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+	assert.NoError(t, repo.Save(ctx, []event.Eventer{evt}), "failed to save events in database")
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()), "hash chain must be valid")
+}
+
+func (s *suite) testSignatures(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "failed to generate key")
+
+	ctx := context.TODO()
+	signedRepo := s.repo(t, "es_events", Options{
+		Signer:           event.NewEd25519Signer("payments", priv),
+		Verifier:         event.NewEd25519Verifier(map[string]ed25519.PublicKey{"payments": pub}),
+		StrictSignatures: true,
+	})
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	events, err := SeedEvents(root, signedRepo)
+	assert.NoError(t, err, "cannot seed events")
+
+	evt, err := signedRepo.Get(ctx, root.GetId(), root.GetType(), events[0].GetVersion())
+	assert.NoError(t, err, "failed to get signed event")
+	assert.Equal(t, "payments", evt.GetSignature().KeyId)
+
+	// Unsigned events are rejected in strict mode
+	unsigned := &TestAggregator{}
+	unsignedRoot := eventsourcing.New(unsigned, unsigned.Transition, eventsourcing.NanoidGenerator)
+	_, err = SeedEvents(unsignedRoot, s.repo(t, "es_events", Options{}))
+	assert.NoError(t, err, "cannot seed events")
+
+	_, err = signedRepo.List(ctx, unsignedRoot.GetId(), unsignedRoot.GetType(), nil)
+	assert.Equal(t, event.ErrSignatureMissing, err)
+
+	_, err = s.db.ExecContext(ctx, "UPDATE es_events SET reason = 'refunded' WHERE aggregate_id = $1", root.GetId())
+	assert.NoError(t, err, "failed to tamper events")
+
+	_, err = signedRepo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.Equal(t, event.ErrSignatureInvalid, err)
+}
+
+func (s *suite) testSignaturesRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "failed to generate key")
+
+	repo := s.repo(t, "es_events", Options{
+		Signer:           event.NewEd25519Signer("payments", priv),
+		Verifier:         event.NewEd25519Verifier(map[string]ed25519.PublicKey{"payments": pub}),
+		StrictSignatures: true,
+	})
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	// Signatures cover timestamps as they are read back from the database
+	evt := event.MustNew(ReasonCreated, Created{Status: "Created"})
+	evt.SetTimestamp(event.Timestamp(time.Date(2024, 1, 1, 0, 0, 0, 999999, time.UTC)))
+	assert.NoError(t, root.Apply(evt), "failed to apply")
+
+	ctx := context.TODO()
+	assert.NoError(t, repo.Save(ctx, []event.Eventer{evt}), "failed to save events in database")
+
+	got, err := repo.Get(ctx, root.GetId(), root.GetType(), evt.GetVersion())
+	assert.NoError(t, err, "signature of read event must be valid")
+	assert.Equal(t, evt.GetSignature(), got.GetSignature())
+
+	list, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "signatures of listed events must be valid")
+	assert.Equal(t, 1, len(list))
+}
+
+func (s *suite) testEncryptedPayloads(t *testing.T) {
+	typ, err := RegisterEncryption(t.TempDir())
+	assert.NoError(t, err, "failed to register serializer")
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	events, err := EncryptedEvents(root, typ)
+	assert.NoError(t, err, "failed to create events")
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+	assert.NoError(t, repo.Save(ctx, events), "failed to save events in database")
+
+	// Saved events are still decoded by the caller
+	var saved Confirmed
+	assert.NoError(t, event.Decode(events[1], &saved), "failed to decode saved event")
+	assert.Equal(t, "Confirmed", saved.Status)
+
+	list, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, event.SerializerTypeJSON, list[1].GetSerializer())
+	assert.JSONEq(t, `{"Status":"Confirmed"}`, string(list[1].GetPayload()))
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()), "chain covers stored payloads")
+
+	// Payloads swapped between rows are not decrypted
+	_, err = s.db.ExecContext(ctx, "UPDATE es_events e SET payload = o.payload FROM es_events o"+
+		" WHERE e.aggregate_id = $1 AND o.aggregate_id = $1 AND e.version = 1 AND o.version = 2", root.GetId())
+	assert.NoError(t, err, "failed to swap payloads")
+
+	_, err = repo.Get(ctx, root.GetId(), root.GetType(), 1)
+	assert.Equal(t, event.ErrDecryption, err)
+}
+
+func (s *suite) testTenantIsolation(t *testing.T) {
+	repo := s.repo(t, "es_events", Options{})
+	tenantA := eventstore.WithTenant(context.TODO(), "tenant_a")
+	tenantB := eventstore.WithTenant(context.TODO(), "tenant_b")
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	root.SetTenantId("tenant_a")
+
+	err := root.Apply(event.MustNew("created", Created{Status: "Created"}))
+	assert.NoError(t, err, "failed to apply")
+	err = repo.Save(tenantA, root.ListUncommittedEvents())
+	assert.NoError(t, err, "failed to save events")
+
+	events, err := repo.List(tenantA, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "tenant_a", events[0].GetTenantId())
+
+	events, err = repo.List(tenantB, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 0, len(events), "tenant must not read events of another tenant")
+
+	_, err = repo.Get(tenantB, root.GetId(), root.GetType(), 1)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+
+	err = repo.Save(tenantB, root.ListUncommittedEvents())
+	assert.Equal(t, eventstore.ErrTenantMismatch, err)
+
+	// Tenants of all streams are checked before any event is scoped
+	other := &TestAggregator{}
+	otherRoot := eventsourcing.New(other, other.Transition, eventsourcing.NanoidGenerator)
+	err = otherRoot.Apply(event.MustNew("created", Created{Status: "Created"}))
+	assert.NoError(t, err, "failed to apply")
+
+	unscoped := otherRoot.ListUncommittedEvents()
+	err = repo.SaveMulti(tenantB, [][]event.Eventer{unscoped, root.ListUncommittedEvents()})
+	assert.Equal(t, eventstore.ErrTenantMismatch, err)
+	assert.Equal(t, "", unscoped[0].GetTenantId(), "events must not be scoped on mismatch")
+}
+
+func (s *suite) testSoftDelete(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	err = repo.SoftDelete(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to delete stream")
+
+	evt := event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+	evt.SetAggregateId(root.GetId())
+	evt.SetAggregateType(root.GetType())
+	evt.SetVersion(events[1].GetVersion() + 2)
+
+	err = repo.Save(ctx, []event.Eventer{evt})
+	var deletedErr *eventstore.StreamDeletedError
+	assert.True(t, errors.As(err, &deletedErr), "error must be *StreamDeletedError")
+
+	err = repo.Verify(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "tombstone must be chained")
+}
+
+func (s *suite) testConfig(t *testing.T) {
+	ctx := context.TODO()
+	cfg := pgschema.Config{
+		Schema:      "Payments",
+		Table:       "Events",
+		Columns:     pgschema.Columns{AggregateId: "stream_id", Payload: "data"},
+		PayloadType: pgschema.PayloadJSONB,
+	}
+	_, err := s.db.ExecContext(ctx, `CREATE SCHEMA "Payments"`)
+	assert.NoError(t, err, "failed to create schema")
+	for _, stmts := range [][]string{pgschema.CreateMigrations(cfg), pgschema.ArchiveMigrations(cfg), pgschema.TruncationMigrations(cfg)} {
+		assert.NoError(t, migrate(ctx, s.db, stmts), "failed to migrate")
+	}
+	repo := s.New(t, cfg, Options{Archive: true, Truncation: true})
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	evt, err := repo.Get(ctx, root.GetId(), root.GetType(), events[1].GetVersion())
+	assert.NoError(t, err, "failed to get event from database")
+	assert.Equal(t, events[1].GetPayload(), evt.GetPayload())
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()), "normalized payloads must be chained")
+
+	// Payload fields are queryable with SQL
+	assert.Equal(t, 1, s.count(t, `SELECT COUNT(*) FROM "Payments"."Events" WHERE stream_id = $1 AND data @> '{"Status": "Confirmed"}'`, root.GetId()))
+
+	// Payloads of failed saves are not normalized
+	conflicted := event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+	conflicted.SetAggregateId(root.GetId())
+	conflicted.SetAggregateType(root.GetType())
+	conflicted.SetVersion(events[1].GetVersion())
+	payload := conflicted.GetPayload()
+	err = repo.Save(ctx, []event.Eventer{conflicted})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	assert.Equal(t, payload, conflicted.GetPayload())
+
+	// Batches are written into the configured table
+	batch := make([]*event.Event, 3)
+	for i := range batch {
+		batch[i] = event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+		assert.NoError(t, root.Apply(batch[i]), "failed to apply")
+	}
+	assert.NoError(t, repo.Save(ctx, event.Covarience(batch)), "failed to save batch")
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()), "batch must be chained")
+
+	next := event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+	next.SetAggregateId(root.GetId())
+	next.SetAggregateType(root.GetType())
+	next.SetVersion(batch[2].GetVersion() + 1)
+	next.SetSerializer(event.SerializerTypeMsgpack)
+	err = repo.Save(ctx, []event.Eventer{next})
+	assert.Equal(t, pgschema.ErrPayloadNotJSON, err)
+
+	// Archive and truncation tables follow the config
+	assert.NoError(t, repo.TruncateBefore(ctx, root.GetId(), root.GetType(), batch[2].GetVersion()), "failed to truncate stream")
+	assert.NoError(t, repo.Archive(ctx, root.GetId(), root.GetType()), "failed to archive stream")
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 1, len(listEvents))
+}
+
+func (s *suite) testUpgradeMigrations(t *testing.T) {
+	ctx := context.TODO()
+	for _, stmt := range []string{
+		`CREATE SCHEMA legacy`,
+		`CREATE TABLE legacy.es_events (
+			aggregate_id   VARCHAR(128) NOT NULL,
+			aggregate_type VARCHAR(128) NOT NULL,
+			reason         TEXT NOT NULL,
+			version        SMALLINT NOT NULL,
+			tstamp         TIMESTAMPTZ NOT NULL,
+			payload        bytea,
+			serializer     VARCHAR(16)
+		)`,
+		"CREATE UNIQUE INDEX id_type_version_un ON legacy.es_events (aggregate_id, aggregate_type, version)",
+		"CREATE INDEX id_type_idx ON legacy.es_events (aggregate_id, aggregate_type)",
+		`INSERT INTO legacy.es_events VALUES ('legacy_0', 'TestAggregator', 'created', 1, now(), '{"Status": "Created"}', 'json')`,
+	} {
+		_, err := s.db.ExecContext(ctx, stmt)
+		assert.NoError(t, err, "failed to create legacy table")
+	}
+
+	cfg := pgschema.Config{Schema: "legacy", Table: "es_events"}
+	assert.NoError(t, migrate(ctx, s.db, pgschema.UpgradeMigrations(cfg)), "failed to upgrade")
+	assert.NoError(t, migrate(ctx, s.db, pgschema.UpgradeMigrations(cfg)), "upgrade must be idempotent")
+
+	// Streams of tenants don't collide after upgrade
+	repo := s.New(t, cfg, Options{})
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	_, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	tenantCtx := eventstore.WithTenant(ctx, "tenant_a")
+	evt := event.MustNew(ReasonCreated, Created{Status: "Created"})
+	evt.SetAggregateId(root.GetId())
+	evt.SetAggregateType(root.GetType())
+	evt.SetVersion(1)
+	assert.NoError(t, repo.Save(tenantCtx, []event.Eventer{evt}), "failed to save events of tenant")
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()), "hash chain must be valid")
+
+	// Chain of the legacy stream starts from the first event saved after upgrade
+	evt = event.MustNew(ReasonConfirmed, Confirmed{Status: "Confirmed"})
+	evt.SetAggregateId("legacy_0")
+	evt.SetAggregateType("TestAggregator")
+	evt.SetVersion(2)
+	assert.NoError(t, repo.Save(ctx, []event.Eventer{evt}), "failed to save events to legacy stream")
+	assert.NoError(t, repo.Verify(ctx, "legacy_0", "TestAggregator"), "hash chain of legacy stream must be valid")
+}
+
+func (s *suite) testLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	repo := s.repo(t, "es_events", Options{Logger: logger})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+	assert.Contains(t, buf.String(), `level=DEBUG msg="events saved"`)
+
+	err = repo.Save(context.TODO(), event.Covarience(events[1:]))
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	assert.Contains(t, buf.String(), `level=WARN msg="concurrency conflict" tenant_id="" aggregate_id=`+root.GetId()+` aggregate_type=TestAggregator version=2 last_version=2`)
+}
+
+// waitBlocked waits until another session waits for a lock held by the
+// session with the pid.
+func (s *suite) waitBlocked(t *testing.T, pid int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for s.count(t, "SELECT COUNT(*) FROM pg_stat_activity WHERE $1 = ANY(pg_blocking_pids(pid))", pid) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no session is blocked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
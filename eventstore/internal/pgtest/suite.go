@@ -0,0 +1,777 @@
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+// Repository is the repository of the PostgreSQL store under the suite.
+// Features which are not covered by eventstore interfaces are adapted by
+// the store tests.
+type Repository interface {
+	eventstore.Repository
+	eventstore.MultiSaver
+	eventstore.IdempotentSaver
+	eventstore.Verifier
+	eventstore.StreamDeleter
+	eventstore.Archiver
+	eventstore.Truncater
+	// Lock locks the stream, see Lock of the store.
+	Lock(ctx context.Context, aggregateID, aggregateType string) (context.Context, StreamLock, error)
+	// EnsurePartitions creates monthly partitions with Partitioner.
+	EnsurePartitions(ctx context.Context, ahead int) error
+	// Scavenge deletes truncated events with Scavenger.
+	Scavenge(ctx context.Context, batchSize int) (int64, error)
+	// Compactor returns Compactor of the repository.
+	Compactor(batchSize int, rules ...pgschema.RetentionRule) Compactor
+}
+
+// StreamLock is the lock returned by Lock of the store.
+type StreamLock interface {
+	Commit(ctx context.Context) error
+	Release(ctx context.Context) error
+}
+
+// Compactor is Compactor of the store.
+type Compactor interface {
+	DryRun(ctx context.Context) ([]pgschema.Retention, error)
+	Compact(ctx context.Context) ([]pgschema.Retention, error)
+}
+
+// Options correspond to options of the store, empty User and Replica
+// connect the repository to the database "test" as superuser "root".
+type Options struct {
+	User             string
+	Password         string
+	Replica          string
+	TenantTables     func(tenantId string) string
+	RowLevelSecurity bool
+	Archive          bool
+	Truncation       bool
+	TimePartitions   bool
+	HashPartitions   bool
+	AdvisoryLocks    bool
+	LockTimeout      time.Duration
+	Signer           event.Signer
+	Verifier         event.SignatureVerifier
+	StrictSignatures bool
+	Logger           *slog.Logger
+}
+
+// Store is the PostgreSQL store under the suite. The database is expected
+// to have "es_events" table with archive and truncation tables.
+type Store struct {
+	// Port is the port of the database passed to Setup.Connect.
+	Port string
+	// New returns repository of the table described by config, connections
+	// opened for the options are closed on the test cleanup.
+	New func(t *testing.T, cfg pgschema.Config, opts Options) Repository
+}
+
+// DSN returns data source name of the database on the port.
+func DSN(port, user, password, database string) string {
+	return fmt.Sprintf("port=%s user=%s password=%s dbname=%s sslmode=disable", port, user, password, database)
+}
+
+// RunSuite runs tests every PostgreSQL store has to pass.
+func RunSuite(t *testing.T, store Store) {
+	db, err := sql.Open("postgres", DSN(store.Port, "root", "root", "test"))
+	if err != nil {
+		t.Fatalf("failed to connect to database: %s", err)
+	}
+	defer db.Close()
+
+	s := &suite{Store: store, db: db}
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"Save", s.testSave},
+		{"Get", s.testGet},
+		{"List", s.testList},
+		{"SaveMulti", s.testSaveMulti},
+		{"SaveIdempotent", s.testSaveIdempotent},
+		{"SaveIdempotentRace", s.testSaveIdempotentRace},
+		{"Verify", s.testVerify},
+		{"VerifySubMicrosecondTimestamps", s.testVerifySubMicrosecondTimestamps},
+		{"Signatures", s.testSignatures},
+		{"SignaturesRoundTrip", s.testSignaturesRoundTrip},
+		{"EncryptedPayloads", s.testEncryptedPayloads},
+		{"TenantIsolation", s.testTenantIsolation},
+		{"SoftDelete", s.testSoftDelete},
+		{"Config", s.testConfig},
+		{"UpgradeMigrations", s.testUpgradeMigrations},
+		{"Logger", s.testLogger},
+		{"TenantTables", s.testTenantTables},
+		{"RowLevelSecurity", s.testRowLevelSecurity},
+		{"HardDelete", s.testHardDelete},
+		{"HardDeleteTruncatedStream", s.testHardDeleteTruncatedStream},
+		{"Archive", s.testArchive},
+		{"TruncateBefore", s.testTruncateBefore},
+		{"Scavenger", s.testScavenger},
+		{"ScavengeDeletedStream", s.testScavengeDeletedStream},
+		{"Compactor", s.testCompactor},
+		{"CompactorLocksStreams", s.testCompactorLocksStreams},
+		{"CompactorStreamRules", s.testCompactorStreamRules},
+		{"CompactorMaxAge", s.testCompactorMaxAge},
+		{"TimePartitions", s.testTimePartitions},
+		{"PartitionsOfDefaultedEvents", s.testPartitionsOfDefaultedEvents},
+		{"HashPartitions", s.testHashPartitions},
+		{"ReadReplica", s.testReadReplica},
+		{"AdvisoryLocks", s.testAdvisoryLocks},
+	} {
+		t.Run(test.name, test.run)
+	}
+}
+
+type suite struct {
+	Store
+	// db is the superuser connection, it prepares tables and checks their
+	// content bypassing the store.
+	db *sql.DB
+}
+
+// migrate executes migration statements in one transaction.
+func migrate(ctx context.Context, db *sql.DB, stmts []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// repo returns repository of the table created with the default layout.
+func (s *suite) repo(t *testing.T, table string, opts Options) Repository {
+	return s.New(t, pgschema.Config{Table: table}, opts)
+}
+
+// count returns result of the COUNT query.
+func (s *suite) count(t *testing.T, q string, args ...interface{}) int {
+	var count int
+	err := s.db.QueryRowContext(context.TODO(), q, args...).Scan(&count)
+	assert.NoError(t, err, "failed to count rows")
+	return count
+}
+
+func (s *suite) testTenantTables(t *testing.T) {
+	ctx := context.TODO()
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE es_events_tenant_c (LIKE es_events INCLUDING ALL)")
+	assert.NoError(t, err, "failed to create tenant table")
+	_, err = s.db.ExecContext(ctx, "CREATE SCHEMA tenant_d")
+	assert.NoError(t, err, "failed to create tenant schema")
+	assert.NoError(t, migrate(ctx, s.db, pgschema.CreateMigrations(pgschema.Config{Schema: "tenant_d", Table: "es_events"})), "failed to migrate")
+
+	repo := s.repo(t, "es_events", Options{TenantTables: func(tenantId string) string {
+		if tenantId == "tenant_d" {
+			return "tenant_d.es_events"
+		}
+		return "es_events_" + tenantId
+	}})
+
+	for _, tenantId := range []string{"tenant_c", "tenant_d"} {
+		agg := &TestAggregator{}
+		root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+		err = root.Apply(event.MustNew("created", Created{Status: "Created"}))
+		assert.NoError(t, err, "failed to apply")
+		err = repo.Save(eventstore.WithTenant(ctx, tenantId), root.ListUncommittedEvents())
+		assert.NoError(t, err, "failed to save events")
+
+		table := "es_events_" + tenantId
+		if tenantId == "tenant_d" {
+			table = "tenant_d.es_events"
+		}
+		assert.Equal(t, 1, s.count(t, "SELECT COUNT(*) FROM "+table+" WHERE aggregate_id = $1", root.GetId()))
+	}
+
+	// Tenant ids are never pasted into SQL
+	_, err = repo.List(eventstore.WithTenant(ctx, "x; DROP TABLE es_events; --"), "agg_0", "TestAggregator", nil)
+	assert.Equal(t, pgschema.ErrInvalidTableName, err)
+}
+
+func (s *suite) testRowLevelSecurity(t *testing.T) {
+	ctx := context.TODO()
+	cfg := pgschema.Config{Table: "es_events_rls"}
+	for _, stmts := range [][]string{
+		pgschema.CreateMigrations(cfg),
+		pgschema.ArchiveMigrations(cfg),
+		pgschema.TruncationMigrations(cfg),
+		pgschema.RowLevelSecurityMigrations(cfg),
+	} {
+		assert.NoError(t, migrate(ctx, s.db, stmts), "failed to migrate")
+	}
+
+	// Superusers bypass row level security, so the store connects as
+	// an ordinary role
+	_, err := s.db.ExecContext(ctx, "CREATE ROLE es_app LOGIN PASSWORD 'app'")
+	assert.NoError(t, err, "failed to create role")
+	_, err = s.db.ExecContext(ctx, "GRANT SELECT, INSERT ON es_events_rls, es_events_rls_archive, es_events_rls_streams TO es_app")
+	assert.NoError(t, err, "failed to grant privileges")
+	appDB, err := sql.Open("postgres", DSN(s.Port, "es_app", "app", "test"))
+	assert.NoError(t, err, "failed to connect as es_app")
+	defer appDB.Close()
+
+	repo := s.repo(t, "es_events_rls", Options{User: "es_app", Password: "app", RowLevelSecurity: true})
+	tenantA := eventstore.WithTenant(ctx, "tenant_a")
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	root.SetTenantId("tenant_a")
+	err = root.Apply(event.MustNew("created", Created{Status: "Created"}))
+	assert.NoError(t, err, "failed to apply")
+	err = repo.Save(tenantA, root.ListUncommittedEvents())
+	assert.NoError(t, err, "failed to save events")
+
+	events, err := repo.List(tenantA, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 1, len(events))
+
+	// Superuser bypasses policies to seed archived events and truncation points
+	_, err = s.db.ExecContext(ctx, "INSERT INTO es_events_rls_archive SELECT * FROM es_events_rls WHERE aggregate_id = $1", root.GetId())
+	assert.NoError(t, err, "failed to archive events")
+	_, err = s.db.ExecContext(ctx, "INSERT INTO es_events_rls_streams (tenant_id, aggregate_id, aggregate_type) VALUES ('tenant_a', $1, 'TestAggregator')", root.GetId())
+	assert.NoError(t, err, "failed to truncate stream")
+
+	// Rows are filtered by the database, even without tenant condition
+	countAs := func(tenantId string, table string) int {
+		tx, err := appDB.BeginTx(ctx, nil)
+		assert.NoError(t, err, "failed to begin transaction")
+		defer tx.Rollback()
+
+		_, err = tx.ExecContext(ctx, pgschema.SetTenantQuery, tenantId)
+		assert.NoError(t, err, "failed to set tenant")
+		var count int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE aggregate_id = $1", root.GetId()).Scan(&count)
+		assert.NoError(t, err, "failed to count rows")
+		return count
+	}
+	for _, table := range []string{"es_events_rls", "es_events_rls_archive", "es_events_rls_streams"} {
+		assert.Equal(t, 1, countAs("tenant_a", table))
+		assert.Equal(t, 0, countAs("tenant_b", table), "tenant must not read rows of another tenant")
+	}
+
+	// Rows of another tenant can't be written either
+	tx, err := appDB.BeginTx(ctx, nil)
+	assert.NoError(t, err, "failed to begin transaction")
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, pgschema.SetTenantQuery, "tenant_b")
+	assert.NoError(t, err, "failed to set tenant")
+	_, err = tx.ExecContext(ctx, "INSERT INTO es_events_rls (tenant_id, aggregate_id, aggregate_type, reason, version, tstamp) VALUES ('tenant_a', 'agg_0', 'TestAggregator', 'created', 1, now())")
+	assert.Error(t, err, "rows of another tenant must be rejected")
+}
+
+func (s *suite) testHardDelete(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Archive: true})
+	_, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	err = repo.HardDelete(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to delete stream")
+
+	events, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 0, len(events))
+}
+
+func (s *suite) testHardDeleteTruncatedStream(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+	assert.NoError(t, repo.TruncateBefore(ctx, root.GetId(), root.GetType(), events[1].GetVersion()), "failed to truncate stream")
+
+	assert.NoError(t, repo.HardDelete(ctx, root.GetId(), root.GetType()), "failed to delete stream")
+	assert.Equal(t, 0, s.count(t, "SELECT COUNT(*) FROM es_events_streams WHERE aggregate_id = $1", root.GetId()), "truncation point must be deleted")
+
+	// Stream recreated with the same id isn't truncated
+	agg = &TestAggregator{}
+	recreated := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	recreated.SetId(root.GetId())
+	_, err = SeedEvents(recreated, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 2, len(listEvents))
+}
+
+func (s *suite) testArchive(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Archive: true})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	err = repo.Archive(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to archive stream")
+	assert.Equal(t, 0, s.count(t, "SELECT COUNT(*) FROM es_events WHERE aggregate_id = $1", root.GetId()), "events must be moved to archive")
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 2, len(listEvents))
+
+	evt, err := repo.Get(ctx, root.GetId(), root.GetType(), events[1].GetVersion())
+	assert.NoError(t, err, "failed to get archived event")
+	assert.Equal(t, "confirmed", evt.GetReason())
+
+	// Appends continue the archived stream
+	next := event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+	next.SetAggregateId(root.GetId())
+	next.SetAggregateType(root.GetType())
+	next.SetVersion(events[1].GetVersion())
+	err = repo.Save(ctx, []event.Eventer{next})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+}
+
+func (s *suite) testTruncateBefore(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	err = repo.TruncateBefore(ctx, root.GetId(), root.GetType(), events[1].GetVersion())
+	assert.NoError(t, err, "failed to truncate stream")
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 1, len(listEvents))
+	assert.Equal(t, events[1].GetVersion(), listEvents[0].GetVersion())
+
+	_, err = repo.Get(ctx, root.GetId(), root.GetType(), events[0].GetVersion())
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()))
+}
+
+func (s *suite) testScavenger(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	err = repo.TruncateBefore(ctx, root.GetId(), root.GetType(), events[1].GetVersion())
+	assert.NoError(t, err, "failed to truncate stream")
+
+	_, err = repo.Scavenge(ctx, 100)
+	assert.NoError(t, err, "failed to scavenge events")
+	assert.Equal(t, 1, s.count(t, "SELECT COUNT(*) FROM es_events WHERE aggregate_id = $1", root.GetId()), "truncated events must be deleted")
+
+	// Non-positive batch size falls back to the default one
+	n, err := repo.Scavenge(ctx, 0)
+	assert.NoError(t, err, "failed to scavenge events")
+	assert.Equal(t, int64(0), n)
+}
+
+func (s *suite) testScavengeDeletedStream(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+	assert.NoError(t, repo.SoftDelete(ctx, root.GetId(), root.GetType()), "failed to delete stream")
+
+	// Truncation above the last version keeps the tombstone
+	err = repo.TruncateBefore(ctx, root.GetId(), root.GetType(), 100)
+	assert.NoError(t, err, "failed to truncate stream")
+	err = repo.TruncateBefore(ctx, root.GetId(), root.GetType(), events[0].GetVersion())
+	assert.NoError(t, err, "failed to truncate stream")
+
+	_, err = repo.Scavenge(ctx, 100)
+	assert.NoError(t, err, "failed to scavenge events")
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	if assert.Equal(t, 1, len(listEvents), "truncation point must not move backwards") {
+		assert.Equal(t, event.ReasonTombstone, listEvents[0].GetReason())
+	}
+
+	evt := event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+	evt.SetAggregateId(root.GetId())
+	evt.SetAggregateType(root.GetType())
+	evt.SetVersion(events[1].GetVersion() + 2)
+	err = repo.Save(ctx, []event.Eventer{evt})
+	var deletedErr *eventstore.StreamDeletedError
+	assert.True(t, errors.As(err, &deletedErr), "scavenged stream must stay deleted")
+}
+
+func (s *suite) testCompactor(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	compactor := repo.Compactor(100, pgschema.RetentionRule{AggregateType: root.GetType(), MaxCount: 1})
+
+	planned, err := compactor.DryRun(ctx)
+	assert.NoError(t, err, "failed to plan compaction")
+
+	var retention *pgschema.Retention
+	for i := range planned {
+		if planned[i].AggregateId == root.GetId() {
+			retention = &planned[i]
+		}
+	}
+	if assert.NotNil(t, retention, "stream must be planned for compaction") {
+		assert.Equal(t, events[1].GetVersion(), retention.TruncateBefore)
+		assert.Equal(t, int64(1), retention.Removed)
+	}
+	assert.Equal(t, 2, s.count(t, "SELECT COUNT(*) FROM es_events WHERE aggregate_id = $1", root.GetId()), "dry run must not remove events")
+
+	_, err = compactor.Compact(ctx)
+	assert.NoError(t, err, "failed to compact")
+	assert.Equal(t, 1, s.count(t, "SELECT COUNT(*) FROM es_events WHERE aggregate_id = $1", root.GetId()), "events out of retention must be removed")
+
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()))
+}
+
+func (s *suite) testCompactorLocksStreams(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true, AdvisoryLocks: true, LockTimeout: 100 * time.Millisecond})
+	_, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	// Truncation point isn't written while the stream is locked
+	_, lock, err := repo.Lock(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to lock stream")
+	compactor := repo.Compactor(0, pgschema.RetentionRule{AggregateType: root.GetType(), MaxCount: 1})
+	_, err = compactor.Compact(ctx)
+	assert.Equal(t, eventstore.ErrLockTimeout, err)
+	assert.NoError(t, lock.Release(ctx), "failed to release lock")
+
+	_, err = compactor.Compact(ctx)
+	assert.NoError(t, err, "failed to compact")
+	assert.Equal(t, 1, s.count(t, "SELECT COUNT(*) FROM es_events WHERE aggregate_id = $1", root.GetId()), "events out of retention must be removed")
+}
+
+func (s *suite) testCompactorStreamRules(t *testing.T) {
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true})
+
+	var roots []*eventsourcing.AggregateCluster
+	for i := 0; i < 3; i++ {
+		agg := &TestAggregator{}
+		root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+		_, err := SeedEvents(root, repo)
+		assert.NoError(t, err, "cannot seed events")
+		roots = append(roots, root)
+	}
+
+	// Stream rules override the rule of the aggregate type
+	compactor := repo.Compactor(100,
+		pgschema.RetentionRule{AggregateType: roots[0].GetType(), MaxCount: 1},
+		pgschema.RetentionRule{AggregateType: roots[1].GetType(), AggregateId: roots[1].GetId(), MaxCount: 5},
+		pgschema.RetentionRule{AggregateType: roots[2].GetType(), AggregateId: roots[2].GetId()},
+	)
+	_, err := compactor.Compact(ctx)
+	assert.NoError(t, err, "failed to compact")
+
+	count := func(root *eventsourcing.AggregateCluster) int {
+		return s.count(t, "SELECT COUNT(*) FROM es_events WHERE aggregate_id = $1", root.GetId())
+	}
+	assert.Equal(t, 1, count(roots[0]), "type rule must remove events")
+	assert.Equal(t, 2, count(roots[1]), "stream rule must override type rule")
+	assert.Equal(t, 2, count(roots[2]), "stream rule without limits must keep events")
+}
+
+func (s *suite) testCompactorMaxAge(t *testing.T) {
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{Truncation: true})
+	aggregateId := eventsourcing.UUIDGenerator("", 0)
+
+	now := time.Now()
+	var events []event.Eventer
+	for i, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, 0} {
+		evt := event.MustNew("issued", Created{Status: "Issued"})
+		evt.SetAggregateId(aggregateId)
+		evt.SetAggregateType("Invoice")
+		evt.SetVersion(event.Version(i + 1))
+		evt.SetTimestamp(event.Timestamp(now.Add(-age)))
+		events = append(events, evt)
+	}
+	assert.NoError(t, repo.Save(ctx, events), "failed to save events")
+
+	compactor := repo.Compactor(100,
+		pgschema.RetentionRule{AggregateType: "Invoice", MaxAge: 24 * time.Hour},
+		pgschema.RetentionRule{AggregateType: "Invoice", MaxCount: 10},
+		pgschema.RetentionRule{AggregateType: "Receipt", MaxAge: time.Hour},
+	)
+	compacted, err := compactor.Compact(ctx)
+	assert.NoError(t, err, "failed to compact")
+
+	var retentions []pgschema.Retention
+	for _, ret := range compacted {
+		if ret.AggregateId == aggregateId {
+			retentions = append(retentions, ret)
+		}
+	}
+	if assert.Equal(t, 1, len(retentions), "only the max age rule removes events") {
+		assert.Equal(t, events[2].GetVersion(), retentions[0].TruncateBefore)
+		assert.Equal(t, int64(2), retentions[0].Removed)
+	}
+
+	listEvents, err := repo.List(ctx, aggregateId, "Invoice", nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 1, len(listEvents))
+	assert.NoError(t, repo.Verify(ctx, aggregateId, "Invoice"))
+}
+
+func (s *suite) testTimePartitions(t *testing.T) {
+	ctx := context.TODO()
+	err := migrate(ctx, s.db, pgschema.TimePartitionMigrations(pgschema.Config{Table: "es_events_by_time"}))
+	assert.NoError(t, err, "failed to migrate")
+	repo := s.repo(t, "es_events_by_time", Options{TimePartitions: true})
+	assert.NoError(t, repo.EnsurePartitions(ctx, 2), "failed to create partitions")
+	assert.NoError(t, repo.EnsurePartitions(ctx, 2), "partitions must be created once")
+	assert.Equal(t, 4, s.count(t, "SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'es_events_by_time'::regclass"), "monthly partitions and the default one")
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), &eventstore.ListFilter{
+		AfterTime: time.Time(events[0].GetTimestamp()).Add(-time.Hour),
+	})
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 2, len(listEvents))
+
+	conflicted := event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+	conflicted.SetAggregateId(root.GetId())
+	conflicted.SetAggregateType(root.GetType())
+	conflicted.SetVersion(events[1].GetVersion())
+	err = repo.Save(ctx, []event.Eventer{conflicted})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+
+	// Events out of created partitions land in the default one
+	old := event.MustNew("created", Created{Status: "Created"})
+	old.SetAggregateId("old")
+	old.SetAggregateType(root.GetType())
+	old.SetVersion(1)
+	old.SetTimestamp(event.Timestamp(time.Now().AddDate(-1, 0, 0)))
+	assert.NoError(t, repo.Save(ctx, []event.Eventer{old}), "failed to save event out of partitions")
+	assert.Equal(t, 1, s.count(t, "SELECT COUNT(*) FROM es_events_by_time_default"))
+
+	assertIdempotencyKeyPerTenant(t, repo)
+}
+
+func (s *suite) testPartitionsOfDefaultedEvents(t *testing.T) {
+	ctx := context.TODO()
+	err := migrate(ctx, s.db, pgschema.TimePartitionMigrations(pgschema.Config{Table: "es_events_defaulted"}))
+	assert.NoError(t, err, "failed to migrate")
+	repo := s.repo(t, "es_events_defaulted", Options{TimePartitions: true})
+
+	// Event saved before the partitioner created its partition
+	evt := event.MustNew("created", Created{Status: "Created"})
+	evt.SetAggregateId("ahead")
+	evt.SetAggregateType("TestAggregator")
+	evt.SetVersion(1)
+	evt.SetTimestamp(event.Timestamp(time.Now().AddDate(0, 3, 0)))
+	assert.NoError(t, repo.Save(ctx, []event.Eventer{evt}), "failed to save event out of partitions")
+
+	assert.NoError(t, repo.EnsurePartitions(ctx, 3), "failed to create partitions")
+	assert.Equal(t, 0, s.count(t, "SELECT COUNT(*) FROM es_events_defaulted_default"), "event must be moved out of the default partition")
+
+	listEvents, err := repo.List(ctx, "ahead", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 1, len(listEvents))
+	assert.NoError(t, repo.Verify(ctx, "ahead", "TestAggregator"))
+}
+
+func (s *suite) testHashPartitions(t *testing.T) {
+	ctx := context.TODO()
+	err := migrate(ctx, s.db, pgschema.HashPartitionMigrations(pgschema.Config{Table: "es_events_by_hash"}, 4))
+	assert.NoError(t, err, "failed to migrate")
+	repo := s.repo(t, "es_events_by_hash", Options{HashPartitions: true})
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	_, err = SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 2, len(listEvents))
+
+	assertIdempotencyKeyPerTenant(t, repo)
+}
+
+// assertIdempotencyKeyPerTenant checks that the idempotency key saved to one
+// stream replays saves to other streams, even if partitions can't keep keys
+// unique.
+func assertIdempotencyKeyPerTenant(t *testing.T, repo Repository) {
+	ctx := context.TODO()
+	key := eventsourcing.UUIDGenerator("", 0)
+
+	for i, aggregateId := range []string{"first_" + key, "second_" + key} {
+		evt := event.MustNew("created", Created{Status: "Created"})
+		evt.SetAggregateId(aggregateId)
+		evt.SetAggregateType("order")
+		evt.SetVersion(1)
+		evt.SetIdempotencyKey(key)
+
+		replayed, err := repo.SaveIdempotent(ctx, []event.Eventer{evt})
+		assert.NoError(t, err, "failed to save events in database")
+		assert.Equal(t, i == 1, replayed, "key must be deduplicated across streams")
+	}
+
+	listEvents, err := repo.List(ctx, "second_"+key, "order", nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 0, len(listEvents))
+}
+
+func (s *suite) testReadReplica(t *testing.T) {
+	ctx := context.TODO()
+
+	// Empty database stands for the replica lagging behind the primary
+	_, err := s.db.ExecContext(ctx, "CREATE DATABASE replica")
+	assert.NoError(t, err, "failed to create replica database")
+	replica, err := sql.Open("postgres", DSN(s.Port, "root", "root", "replica"))
+	assert.NoError(t, err, "failed to connect to replica")
+	defer replica.Close()
+	assert.NoError(t, migrate(ctx, replica, pgschema.CreateMigrations(pgschema.Config{Table: "es_events"})), "failed to migrate replica")
+
+	repo := s.repo(t, "es_events", Options{Replica: "replica"})
+	token := eventstore.NewVersionToken()
+	tokenCtx := eventstore.WithVersionToken(ctx, token)
+
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	err = root.Apply(event.MustNew("created", Created{Status: "Created"}))
+	assert.NoError(t, err, "failed to apply")
+	err = repo.Save(tokenCtx, root.ListUncommittedEvents())
+	assert.NoError(t, err, "failed to save events")
+	assert.Equal(t, event.Version(1), token.Version("", root.GetId(), root.GetType()))
+
+	events, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 0, len(events), "reads must be served by replica")
+
+	events, err = repo.List(tokenCtx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 1, len(events), "reads of own writes must be served by primary")
+}
+
+func (s *suite) testAdvisoryLocks(t *testing.T) {
+	agg := &TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := s.repo(t, "es_events", Options{AdvisoryLocks: true, LockTimeout: 100 * time.Millisecond})
+	events, err := SeedEvents(root, repo)
+	assert.NoError(t, err, "cannot seed events")
+
+	lockCtx, lock, err := repo.Lock(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to lock stream")
+	defer lock.Release(ctx)
+
+	next := func(version event.Version) event.Eventer {
+		evt := event.MustNew("confirmed", Confirmed{Status: "Confirmed"})
+		evt.SetAggregateId(root.GetId())
+		evt.SetAggregateType(root.GetType())
+		evt.SetVersion(version)
+		return evt
+	}
+
+	// Other writers wait for the lock
+	err = repo.Save(ctx, []event.Eventer{next(events[1].GetVersion() + 1)})
+	assert.Equal(t, eventstore.ErrLockTimeout, err)
+
+	listEvents, err := repo.List(lockCtx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 2, len(listEvents))
+
+	err = repo.Save(lockCtx, []event.Eventer{next(events[1].GetVersion() + 1)})
+	assert.NoError(t, err, "failed to save events under lock")
+	assert.NoError(t, lock.Commit(ctx), "failed to commit lock")
+
+	listEvents, err = repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, 3, len(listEvents))
+
+	// Streams saved together are locked in the same order
+	other := &TestAggregator{}
+	otherRoot := eventsourcing.New(other, other.Transition, eventsourcing.NanoidGenerator)
+	err = otherRoot.Apply(event.MustNew("created", Created{Status: "Created"}))
+	assert.NoError(t, err, "failed to apply")
+	err = repo.SaveMulti(ctx, [][]event.Eventer{{next(events[1].GetVersion() + 2)}, otherRoot.ListUncommittedEvents()})
+	assert.NoError(t, err, "failed to save events")
+
+	// Locks of other repositories are not joined, even of the same table
+	lockCtx, lock, err = repo.Lock(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to lock stream")
+	foreign := s.repo(t, "es_events", Options{AdvisoryLocks: true, LockTimeout: 100 * time.Millisecond})
+	err = foreign.Save(lockCtx, []event.Eventer{next(events[1].GetVersion() + 3)})
+	assert.Equal(t, pgstore.ErrForeignLock, err)
+	_, err = foreign.List(lockCtx, root.GetId(), root.GetType(), nil)
+	assert.Equal(t, pgstore.ErrForeignLock, err)
+	assert.NoError(t, lock.Release(ctx), "failed to release lock")
+
+	// Deletion waits for the lock as well
+	_, lock, err = repo.Lock(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to lock stream")
+	err = repo.HardDelete(ctx, root.GetId(), root.GetType())
+	assert.Equal(t, eventstore.ErrLockTimeout, err)
+	assert.NoError(t, lock.Release(ctx), "failed to release lock")
+
+	// Under the lock streams sorted before the locked one aren't waited for
+	slow := s.repo(t, "es_events", Options{AdvisoryLocks: true, LockTimeout: 5 * time.Second})
+	_, accountLock, err := slow.Lock(ctx, root.GetId(), "Account")
+	assert.NoError(t, err, "failed to lock stream")
+	defer accountLock.Release(ctx)
+	lockCtx, lock, err = slow.Lock(ctx, root.GetId(), root.GetType())
+	assert.NoError(t, err, "failed to lock stream")
+	defer lock.Release(ctx)
+
+	account := event.MustNew("created", Created{Status: "Created"})
+	account.SetAggregateId(root.GetId())
+	account.SetAggregateType("Account")
+	account.SetVersion(1)
+	started := time.Now()
+	err = slow.SaveMulti(lockCtx, [][]event.Eventer{{next(events[1].GetVersion() + 3)}, {account}})
+	assert.Equal(t, eventstore.ErrLockTimeout, err)
+	assert.Less(t, time.Since(started), time.Second, "out of order lock must not be waited for")
+}
@@ -0,0 +1,387 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/internal/logging"
+)
+
+type streamKey struct {
+	tenantId      string
+	aggregateId   string
+	aggregateType string
+}
+
+func streamKeyOf(evt event.Eventer) streamKey {
+	return streamKey{evt.GetTenantId(), evt.GetAggregateId(), evt.GetAggregateType()}
+}
+
+type idempotencyKey struct {
+	tenantId string
+	key      string
+}
+
+// eventRepository is an in-process event store. It is intended for tests
+// and prototyping, all events are lost when the process exits.
+type eventRepository struct {
+	mu      sync.RWMutex
+	streams map[streamKey][]event.Eventer
+	keys    map[idempotencyKey]struct{}
+	// archived holds events moved out of streams by Archive.
+	archived map[streamKey][]event.Eventer
+	// truncated holds versions streams are truncated before.
+	truncated map[streamKey]event.Version
+	logger    *slog.Logger
+}
+
+// Option configures eventRepository.
+type Option func(r *eventRepository)
+
+// WithLogger sets logger of concurrency conflicts, nothing is logged by
+// default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *eventRepository) {
+		r.logger = logger
+	}
+}
+
+var (
+	_ (eventstore.Repository)      = &eventRepository{}
+	_ (eventstore.MultiSaver)      = &eventRepository{}
+	_ (eventstore.IdempotentSaver) = &eventRepository{}
+	_ (eventstore.Verifier)        = &eventRepository{}
+	_ (eventstore.StreamDeleter)   = &eventRepository{}
+	_ (eventstore.Archiver)        = &eventRepository{}
+	_ (eventstore.Truncater)       = &eventRepository{}
+)
+
+func New(opts ...Option) *eventRepository {
+	r := &eventRepository{
+		streams:   make(map[streamKey][]event.Eventer),
+		keys:      make(map[idempotencyKey]struct{}),
+		archived:  make(map[streamKey][]event.Eventer),
+		truncated: make(map[streamKey]event.Version),
+		logger:    logging.Discard(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *eventRepository) Get(ctx context.Context, aggregateID, aggregateType string, version event.Version) (event.Eventer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := streamKey{eventstore.TenantFromContext(ctx), aggregateID, aggregateType}
+	for _, evt := range r.stream(key) {
+		if evt.GetVersion() == version && version >= r.truncated[key] {
+			c := clone(evt)
+			if err := event.DecryptEvent(c); err != nil {
+				return nil, err
+			}
+			return c, nil
+		}
+	}
+	return nil, eventstore.ErrEventNotFound
+}
+
+func (r *eventRepository) List(ctx context.Context, aggregateID, aggregateType string, filter *eventstore.ListFilter) ([]event.Eventer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := streamKey{eventstore.TenantFromContext(ctx), aggregateID, aggregateType}
+	stream := r.stream(key)
+	events := make([]event.Eventer, 0, len(stream))
+	for _, evt := range stream {
+		if evt.GetVersion() < r.truncated[key] {
+			continue
+		}
+		if filter != nil && filter.BeforeVersion > 0 && evt.GetVersion() >= filter.BeforeVersion {
+			continue
+		}
+		if filter != nil && filter.AfterVersion > 0 && evt.GetVersion() <= filter.AfterVersion {
+			continue
+		}
+		if filter != nil && !filter.BeforeTime.IsZero() && !time.Time(evt.GetTimestamp()).Before(filter.BeforeTime) {
+			continue
+		}
+		if filter != nil && !filter.AfterTime.IsZero() && time.Time(evt.GetTimestamp()).Before(filter.AfterTime) {
+			continue
+		}
+		if filter != nil && filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		events = append(events, clone(evt))
+	}
+	if err := eventstore.DecryptPayloads(events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *eventRepository) Save(ctx context.Context, events []event.Eventer) error {
+	_, err := r.SaveIdempotent(ctx, events)
+	return err
+}
+
+func (r *eventRepository) SaveIdempotent(ctx context.Context, events []event.Eventer) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := eventstore.ScopeTenant(ctx, events); err != nil {
+		return false, err
+	}
+	replayed, err := r.replayed(events)
+	if err != nil || replayed {
+		return replayed, err
+	}
+	return false, r.saveMulti(ctx, [][]event.Eventer{events})
+}
+
+func (r *eventRepository) SaveMulti(ctx context.Context, streams [][]event.Eventer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := eventstore.ScopeTenantStreams(ctx, streams); err != nil {
+		return err
+	}
+
+	pending := make([][]event.Eventer, 0, len(streams))
+	for _, events := range streams {
+		replayed, err := r.replayed(events)
+		if err != nil {
+			return err
+		}
+		if !replayed {
+			pending = append(pending, events)
+		}
+	}
+	return r.saveMulti(ctx, pending)
+}
+
+func (r *eventRepository) saveMulti(ctx context.Context, streams [][]event.Eventer) error {
+	// Validate all streams before any of them is written, so that
+	// either all streams are saved or none. Streams of the same aggregate
+	// are checked against the events pending earlier in the batch.
+	pending := make(map[streamKey]event.Eventer, len(streams))
+	for _, events := range streams {
+		if len(events) == 0 {
+			continue
+		}
+		if err := eventstore.ValidateStream(events); err != nil {
+			return err
+		}
+		key := streamKeyOf(events[0])
+		last, ok := pending[key]
+		if !ok {
+			last = r.last(key)
+		}
+		if err := r.controlConcurrency(ctx, events[0], last); err != nil {
+			return err
+		}
+		pending[key] = events[len(events)-1]
+	}
+	unbind, err := eventstore.BindPayloads(streams...)
+	if err != nil {
+		return err
+	}
+	defer unbind()
+
+	for _, events := range streams {
+		if len(events) == 0 {
+			continue
+		}
+
+		var prev event.Hash
+		if last := r.last(streamKeyOf(events[0])); last != nil {
+			prev = last.GetHash()
+		}
+		eventstore.ChainHashes(prev, events)
+
+		for _, evt := range events {
+			key := streamKeyOf(evt)
+			r.streams[key] = append(r.streams[key], clone(evt))
+			if evt.GetIdempotencyKey() != "" {
+				r.keys[idempotencyKey{evt.GetTenantId(), evt.GetIdempotencyKey()}] = struct{}{}
+			}
+		}
+	}
+
+	return nil
+}
+
+// replayed reports whether all keyed events were already saved.
+func (r *eventRepository) replayed(events []event.Eventer) (bool, error) {
+	keys := eventstore.IdempotencyKeys(events)
+	found := 0
+	for _, key := range keys {
+		if _, ok := r.keys[idempotencyKey{events[0].GetTenantId(), key}]; ok {
+			found++
+		}
+	}
+
+	switch {
+	case found == 0:
+		return false, nil
+	case found == len(keys):
+		return true, nil
+	}
+	return false, eventstore.ErrIdempotencyConflict
+}
+
+func (r *eventRepository) Verify(ctx context.Context, aggregateID, aggregateType string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := streamKey{eventstore.TenantFromContext(ctx), aggregateID, aggregateType}
+	stream := r.stream(key)
+	for len(stream) != 0 && stream[0].GetVersion() < r.truncated[key] {
+		stream = stream[1:]
+	}
+	if len(stream) != 0 && stream[0].GetVersion() == r.truncated[key] {
+		return eventstore.VerifyChainFrom(stream[0].GetPrevHash(), stream)
+	}
+	return eventstore.VerifyChain(stream)
+}
+
+func (r *eventRepository) TruncateBefore(ctx context.Context, aggregateID, aggregateType string, version event.Version) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := streamKey{eventstore.TenantFromContext(ctx), aggregateID, aggregateType}
+	last := r.last(key)
+	if last == nil {
+		return eventstore.ErrEventNotFound
+	}
+	if version > last.GetVersion() {
+		version = last.GetVersion()
+	}
+	if version > r.truncated[key] {
+		r.truncated[key] = version
+	}
+	return nil
+}
+
+func (r *eventRepository) SoftDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last := r.last(streamKey{eventstore.TenantFromContext(ctx), aggregateID, aggregateType})
+	if last == nil {
+		return eventstore.ErrEventNotFound
+	}
+
+	tombstone := event.NewTombstone(aggregateID, aggregateType, last.GetVersion()+event.NextVersion)
+	tombstone.SetTenantId(eventstore.TenantFromContext(ctx))
+	return r.saveMulti(ctx, [][]event.Eventer{{tombstone}})
+}
+
+func (r *eventRepository) HardDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := streamKey{eventstore.TenantFromContext(ctx), aggregateID, aggregateType}
+	for _, evt := range r.stream(key) {
+		delete(r.keys, idempotencyKey{evt.GetTenantId(), evt.GetIdempotencyKey()})
+	}
+	delete(r.streams, key)
+	delete(r.archived, key)
+	delete(r.truncated, key)
+	return nil
+}
+
+// Archive moves all events of the stream into the archive. Archived events
+// are still read, appends continue the stream.
+func (r *eventRepository) Archive(ctx context.Context, aggregateID, aggregateType string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := streamKey{eventstore.TenantFromContext(ctx), aggregateID, aggregateType}
+	if len(r.streams[key]) != 0 {
+		r.archived[key] = append(r.archived[key], r.streams[key]...)
+		delete(r.streams, key)
+	}
+	return nil
+}
+
+// stream returns archived and live events of the stream in version order.
+func (r *eventRepository) stream(key streamKey) []event.Eventer {
+	archived := r.archived[key]
+	if len(archived) == 0 {
+		return r.streams[key]
+	}
+	return append(archived[:len(archived):len(archived)], r.streams[key]...)
+}
+
+// last returns the last saved event of the stream, or nil.
+func (r *eventRepository) last(key streamKey) event.Eventer {
+	if stream := r.streams[key]; len(stream) != 0 {
+		return stream[len(stream)-1]
+	}
+	if archived := r.archived[key]; len(archived) != 0 {
+		return archived[len(archived)-1]
+	}
+	return nil
+}
+
+func (r *eventRepository) controlConcurrency(ctx context.Context, evt, last event.Eventer) error {
+	lastAggregateVersion := event.EmptyVersion
+	if last != nil {
+		if event.IsTombstone(last) {
+			r.log(ctx, "save to deleted stream", evt, last.GetVersion())
+			return &eventstore.StreamDeletedError{
+				AggregateId:   last.GetAggregateId(),
+				AggregateType: last.GetAggregateType(),
+				Version:       last.GetVersion(),
+			}
+		}
+		lastAggregateVersion = last.GetVersion()
+	}
+
+	// Check that no other versions are inserted
+	if (lastAggregateVersion + event.NextVersion) != evt.GetVersion() {
+		r.log(ctx, "concurrency conflict", evt, lastAggregateVersion)
+		return &eventstore.ConcurrencyError{
+			AggregateId:   evt.GetAggregateId(),
+			AggregateType: evt.GetAggregateType(),
+			Version:       evt.GetVersion(),
+		}
+	}
+	return nil
+}
+
+func (r *eventRepository) log(ctx context.Context, msg string, evt event.Eventer, lastVersion event.Version) {
+	r.logger.LogAttrs(ctx, slog.LevelWarn, msg,
+		append(logging.StreamAttrs(evt.GetTenantId(), evt.GetAggregateId(), evt.GetAggregateType(), evt.GetVersion()), slog.Int("last_version", int(lastVersion)))...)
+}
+
+// clone copies the event, so that stored events are never shared with
+// callers.
+func clone(evt event.Eventer) event.Eventer {
+	c := new(event.Event)
+	c.SetTenantId(evt.GetTenantId())
+	c.SetAggregateId(evt.GetAggregateId())
+	c.SetAggregateType(evt.GetAggregateType())
+	c.SetReason(evt.GetReason())
+	c.SetVersion(evt.GetVersion())
+	c.SetTimestamp(evt.GetTimestamp())
+	c.SetPayload(append(event.Payload(nil), evt.GetPayload()...))
+	c.SetSerializer(evt.GetSerializer())
+	c.SetIdempotencyKey(evt.GetIdempotencyKey())
+	c.SetHash(evt.GetHash())
+	c.SetPrevHash(evt.GetPrevHash())
+	if metadata := evt.GetMetadata(); metadata != nil {
+		c.SetMetadata(make(event.Metadata, len(metadata)))
+		for key, value := range metadata {
+			c.GetMetadata()[key] = value
+		}
+	}
+	c.SetSignature(evt.GetSignature())
+	return c
+}
@@ -0,0 +1,403 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+)
+
+func newTestEvent(aggregateId string, version event.Version, reason string) *event.Event {
+	evt := event.MustNew(reason, struct{ Status string }{Status: reason})
+	evt.SetAggregateId(aggregateId)
+	evt.SetAggregateType("TestAggregator")
+	evt.SetVersion(version)
+	return evt
+}
+
+func TestSaveGetList(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	events := []*event.Event{
+		newTestEvent("agg_0", 1, "created"),
+		newTestEvent("agg_0", 2, "confirmed"),
+	}
+	err := repo.Save(ctx, event.Covarience(events))
+	assert.NoError(t, err, "failed to save events")
+
+	evt, err := repo.Get(ctx, "agg_0", "TestAggregator", 2)
+	assert.NoError(t, err, "failed to get event")
+	assert.Equal(t, "confirmed", evt.GetReason())
+
+	_, err = repo.Get(ctx, "agg_0", "TestAggregator", 3)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", &eventstore.ListFilter{AfterVersion: 1})
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 1, len(list))
+}
+
+func TestSaveConcurrency(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1, "created")})
+	assert.NoError(t, err, "failed to save events")
+
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1, "created")})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+}
+
+func TestSaveMixedAggregates(t *testing.T) {
+	err := New().Save(context.TODO(), []event.Eventer{
+		newTestEvent("agg_0", 1, "created"),
+		newTestEvent("agg_1", 1, "created"),
+	})
+	assert.Equal(t, eventstore.ErrMixedAggregates, err)
+}
+
+func TestSaveMultiAtomic(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.Save(ctx, []event.Eventer{newTestEvent("agg_1", 1, "created")})
+	assert.NoError(t, err, "failed to save events")
+
+	err = repo.SaveMulti(ctx, [][]event.Eventer{
+		{newTestEvent("agg_0", 1, "created")},
+		{newTestEvent("agg_1", 1, "created")}, // version conflict
+	})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 0, len(list), "events of the first aggregate must not be saved")
+}
+
+func TestSaveMultiSameAggregate(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.SaveMulti(ctx, [][]event.Eventer{
+		{newTestEvent("agg_0", 1, "created")},
+		{newTestEvent("agg_0", 1, "created")}, // duplicate version
+	})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 0, len(list), "no events must be saved")
+
+	err = repo.SaveMulti(ctx, [][]event.Eventer{
+		{newTestEvent("agg_0", 1, "created")},
+		{newTestEvent("agg_0", 2, "confirmed")},
+	})
+	assert.NoError(t, err, "failed to save consecutive streams")
+
+	list, err = repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 2, len(list))
+	assert.NoError(t, repo.Verify(ctx, "agg_0", "TestAggregator"))
+}
+
+func TestSaveIdempotent(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	first := newTestEvent("agg_0", 1, "created")
+	first.SetIdempotencyKey("request_0")
+	replayed, err := repo.SaveIdempotent(ctx, []event.Eventer{first})
+	assert.NoError(t, err, "failed to save events")
+	assert.False(t, replayed)
+
+	// Retried request is appended at the next version
+	retried := newTestEvent("agg_0", 2, "created")
+	retried.SetIdempotencyKey("request_0")
+	replayed, err = repo.SaveIdempotent(ctx, []event.Eventer{retried})
+	assert.NoError(t, err, "failed to save events")
+	assert.True(t, replayed)
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 1, len(list))
+
+	partial := []event.Eventer{newTestEvent("agg_0", 2, "created"), newTestEvent("agg_0", 3, "confirmed")}
+	event.SetBatchIdempotencyKey(partial, "request_1")
+	partial[0].SetIdempotencyKey("request_0")
+	_, err = repo.SaveIdempotent(ctx, partial)
+	assert.Equal(t, eventstore.ErrIdempotencyConflict, err)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.Save(ctx, []event.Eventer{
+		newTestEvent("agg_0", 1, "created"),
+		newTestEvent("agg_0", 2, "confirmed"),
+	})
+	assert.NoError(t, err, "failed to save events")
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 3, "refunded")})
+	assert.NoError(t, err, "failed to save events")
+
+	assert.NoError(t, repo.Verify(ctx, "agg_0", "TestAggregator"))
+
+	// Tamper stored event
+	repo.streams[streamKey{"", "agg_0", "TestAggregator"}][1].SetReason("refunded")
+
+	err = repo.Verify(ctx, "agg_0", "TestAggregator")
+	assert.True(t, errors.Is(err, eventstore.ErrChainBroken))
+	chainErr, ok := err.(*eventstore.ChainError)
+	assert.True(t, ok, "error must be *ChainError")
+	assert.Equal(t, event.Version(2), chainErr.Version)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	repo := New()
+	tenantA := eventstore.WithTenant(context.TODO(), "tenant_a")
+	tenantB := eventstore.WithTenant(context.TODO(), "tenant_b")
+
+	err := repo.Save(tenantA, []event.Eventer{newTestEvent("agg_0", 1, "created")})
+	assert.NoError(t, err, "failed to save events")
+
+	// Same aggregate id of another tenant is a separate stream
+	err = repo.Save(tenantB, []event.Eventer{newTestEvent("agg_0", 1, "created")})
+	assert.NoError(t, err, "failed to save events")
+
+	list, err := repo.List(tenantA, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, "tenant_a", list[0].GetTenantId())
+
+	list, err = repo.List(context.TODO(), "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 0, len(list), "default tenant must not read other tenants")
+
+	evt := newTestEvent("agg_0", 2, "confirmed")
+	evt.SetTenantId("tenant_b")
+	err = repo.Save(tenantA, []event.Eventer{evt})
+	assert.Equal(t, eventstore.ErrTenantMismatch, err)
+
+	// Tenants of all streams are checked before any event is scoped
+	unscoped := newTestEvent("agg_1", 1, "created")
+	err = repo.SaveMulti(tenantA, [][]event.Eventer{{unscoped}, {evt}})
+	assert.Equal(t, eventstore.ErrTenantMismatch, err)
+	assert.Equal(t, "", unscoped.GetTenantId(), "events must not be scoped on mismatch")
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1, "created")})
+	assert.NoError(t, err, "failed to save events")
+
+	assert.NoError(t, repo.SoftDelete(ctx, "agg_0", "TestAggregator"), "failed to delete stream")
+
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 3, "confirmed")})
+	var deletedErr *eventstore.StreamDeletedError
+	assert.True(t, errors.As(err, &deletedErr), "error must be *StreamDeletedError")
+	assert.Equal(t, event.Version(2), deletedErr.Version)
+	assert.True(t, errors.Is(err, eventstore.ErrStreamDeleted))
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 2, len(list))
+	assert.True(t, event.IsTombstone(list[1]))
+
+	assert.Equal(t, eventstore.ErrEventNotFound, repo.SoftDelete(ctx, "agg_1", "TestAggregator"))
+}
+
+func TestHardDelete(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	evt := newTestEvent("agg_0", 1, "created")
+	evt.SetIdempotencyKey("request_0")
+	err := repo.Save(ctx, []event.Eventer{evt})
+	assert.NoError(t, err, "failed to save events")
+
+	assert.NoError(t, repo.HardDelete(ctx, "agg_0", "TestAggregator"), "failed to delete stream")
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 0, len(list))
+}
+
+func TestTruncateBefore(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.Save(ctx, []event.Eventer{
+		newTestEvent("agg_0", 1, "created"),
+		newTestEvent("agg_0", 2, "confirmed"),
+		newTestEvent("agg_0", 3, "refunded"),
+	})
+	assert.NoError(t, err, "failed to save events")
+
+	assert.NoError(t, repo.TruncateBefore(ctx, "agg_0", "TestAggregator", 2), "failed to truncate stream")
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, event.Version(2), list[0].GetVersion())
+
+	_, err = repo.Get(ctx, "agg_0", "TestAggregator", 1)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+
+	assert.NoError(t, repo.Verify(ctx, "agg_0", "TestAggregator"))
+
+	// Truncation point never moves backwards
+	assert.NoError(t, repo.TruncateBefore(ctx, "agg_0", "TestAggregator", 1), "failed to truncate stream")
+	list, err = repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 2, len(list))
+
+	err = repo.TruncateBefore(ctx, "agg_1", "TestAggregator", 1)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+}
+
+func TestTruncateDeletedStream(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.Save(ctx, []event.Eventer{
+		newTestEvent("agg_0", 1, "created"),
+		newTestEvent("agg_0", 2, "confirmed"),
+	})
+	assert.NoError(t, err, "failed to save events")
+	assert.NoError(t, repo.SoftDelete(ctx, "agg_0", "TestAggregator"), "failed to delete stream")
+
+	// Truncation above the last version keeps the tombstone
+	assert.NoError(t, repo.TruncateBefore(ctx, "agg_0", "TestAggregator", 100), "failed to truncate stream")
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	if assert.Equal(t, 1, len(list)) {
+		assert.Equal(t, event.ReasonTombstone, list[0].GetReason())
+	}
+
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 4, "reopened")})
+	var deleted *eventstore.StreamDeletedError
+	assert.ErrorAs(t, err, &deleted)
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	err := repo.Save(ctx, []event.Eventer{
+		newTestEvent("agg_0", 1, "created"),
+		newTestEvent("agg_0", 2, "confirmed"),
+	})
+	assert.NoError(t, err, "failed to save events")
+	assert.NoError(t, repo.Archive(ctx, "agg_0", "TestAggregator"), "failed to archive stream")
+
+	// Appends continue the archived stream
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 2, "refunded")})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 3, "refunded")})
+	assert.NoError(t, err, "failed to save events")
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 3, len(list), "archived events must be read")
+
+	_, err = repo.Get(ctx, "agg_0", "TestAggregator", 1)
+	assert.NoError(t, err, "failed to get archived event")
+	assert.NoError(t, repo.Verify(ctx, "agg_0", "TestAggregator"))
+
+	assert.NoError(t, repo.HardDelete(ctx, "agg_0", "TestAggregator"), "failed to delete stream")
+	list, err = repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 0, len(list), "archived events must be deleted")
+}
+
+func TestEncryptedPayloads(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, event.WriteKeyFile(dir, "key_0"))
+	keys, err := event.NewFileKeyProvider(dir, "key_0")
+	assert.NoError(t, err, "failed to load keys")
+	typ, err := event.RegisterEncryptingSerializer(event.SerializerTypeJSON, keys)
+	assert.NoError(t, err, "failed to register serializer")
+
+	ctx := context.TODO()
+	repo := New()
+
+	var events []event.Eventer
+	for i, reason := range []string{"created", "confirmed"} {
+		evt, err := event.NewWithSerializer(reason, struct{ Status string }{Status: reason}, typ)
+		assert.NoError(t, err, "failed to create event")
+		evt.SetAggregateId("agg_0")
+		evt.SetAggregateType("TestAggregator")
+		evt.SetVersion(event.Version(i + 1))
+		events = append(events, evt)
+	}
+	assert.NoError(t, repo.Save(ctx, events), "failed to save events")
+
+	// Saved events are still decoded by the caller
+	var saved struct{ Status string }
+	assert.NoError(t, event.Decode(events[1], &saved), "failed to decode saved event")
+	assert.Equal(t, "confirmed", saved.Status)
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, event.SerializerTypeJSON, list[1].GetSerializer())
+	assert.JSONEq(t, `{"Status":"confirmed"}`, string(list[1].GetPayload()))
+	assert.NoError(t, repo.Verify(ctx, "agg_0", "TestAggregator"), "chain covers stored payloads")
+
+	// Payloads swapped between events are not decrypted
+	stream := repo.streams[streamKey{"", "agg_0", "TestAggregator"}]
+	stream[0], stream[1] = stream[1], stream[0]
+	stream[0].SetVersion(1)
+	stream[1].SetVersion(2)
+	_, err = repo.Get(ctx, "agg_0", "TestAggregator", 1)
+	assert.Equal(t, event.ErrDecryption, err)
+}
+
+func TestListTimeFilter(t *testing.T) {
+	ctx := context.TODO()
+	repo := New()
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []event.Eventer{
+		newTestEvent("agg_0", 1, "created"),
+		newTestEvent("agg_0", 2, "confirmed"),
+		newTestEvent("agg_0", 3, "refunded"),
+	}
+	for i, evt := range events {
+		evt.SetTimestamp(event.Timestamp(day.AddDate(0, 0, i)))
+	}
+	err := repo.Save(ctx, events)
+	assert.NoError(t, err, "failed to save events")
+
+	list, err := repo.List(ctx, "agg_0", "TestAggregator", &eventstore.ListFilter{
+		AfterTime:  day.AddDate(0, 0, 1),
+		BeforeTime: day.AddDate(0, 0, 2),
+	})
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, event.Version(2), list[0].GetVersion())
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := context.TODO()
+	repo := New(WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	err := repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1, "created")})
+	assert.NoError(t, err, "failed to save events")
+	assert.Empty(t, buf.String())
+
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1, "created")})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	assert.Contains(t, buf.String(), `level=WARN msg="concurrency conflict" tenant_id="" aggregate_id=agg_0 aggregate_type=TestAggregator version=1 last_version=1`)
+}
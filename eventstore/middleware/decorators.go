@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+)
+
+// Timeout limits duration of every call.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op Op) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, op)
+		}
+	}
+}
+
+// Transient reports whether err is a transient infrastructure failure, e.g.
+// broken connection, network error, expired call timeout or lock timeout.
+// Domain errors such as eventstore.ErrControlConcurrency are never
+// transient.
+func Transient(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, eventstore.ErrLockTimeout),
+		errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+// RetryPolicy describes retries of failed calls.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts including the first one.
+	Attempts int
+	// Backoff is delay before the first retry, it's doubled for every
+	// next retry.
+	Backoff time.Duration
+	// Retryable reports whether the call should be retried, Transient by
+	// default.
+	Retryable func(err error) bool
+}
+
+// Retry retries calls failed with retryable errors. Saves are retried as
+// well, so batches should carry idempotency keys to not be saved twice
+// when the first attempt was committed, but its result was lost.
+func Retry(policy RetryPolicy) Middleware {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = Transient
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op Op) error {
+			backoff := policy.Backoff
+			for attempt := 1; ; attempt++ {
+				err := next(ctx, op)
+				if err == nil || attempt >= policy.Attempts || !retryable(err) || ctx.Err() != nil {
+					return err
+				}
+
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(backoff):
+				}
+				backoff *= 2
+			}
+		}
+	}
+}
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker fails calls with ErrCircuitOpen without calling repository
+// after threshold of consecutive transient failures. After cooldown a single
+// trial call is let through, it closes the circuit on success.
+func CircuitBreaker(threshold int, cooldown time.Duration) Middleware {
+	b := &breaker{threshold: threshold, cooldown: cooldown}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op Op) error {
+			allowed, trial := b.allow()
+			if !allowed {
+				return ErrCircuitOpen
+			}
+			// Panicking call counts as failure, so the trial is finished
+			// and the circuit stays open for another cooldown
+			failed := true
+			defer func() { b.record(trial, failed) }()
+
+			err := next(ctx, op)
+			failed = Transient(err)
+			return err
+		}
+	}
+}
+
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// allow reports whether the call may proceed and whether it is the trial
+// call of open circuit.
+func (b *breaker) allow() (allowed, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true, false
+	}
+	// Open circuit lets through single trial call after cooldown
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false, false
+	}
+	b.trial = true
+	return true, true
+}
+
+func (b *breaker) record(trial, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Only the trial call finishes the trial, calls let through before
+	// the circuit opened must not start another one
+	if trial {
+		b.trial = false
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// Logging logs every call with its duration, failed calls are logged with
+// error level. eventstore.ErrEventNotFound is an expected outcome of reads,
+// such calls are logged with debug level.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op Op) error {
+			start := time.Now()
+			err := next(ctx, op)
+
+			attrs := []slog.Attr{
+				slog.String("method", op.Method),
+				slog.String("aggregate_id", op.AggregateId),
+				slog.String("aggregate_type", op.AggregateType),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if errors.Is(err, eventstore.ErrEventNotFound) {
+				logger.LogAttrs(ctx, slog.LevelDebug, "event store call", append(attrs, slog.Any("error", err))...)
+				return err
+			}
+			if err != nil {
+				logger.LogAttrs(ctx, slog.LevelError, "event store call failed", append(attrs, slog.Any("error", err))...)
+				return err
+			}
+			logger.LogAttrs(ctx, slog.LevelDebug, "event store call", attrs...)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package middleware decorates any eventstore.Repository with timeouts,
+// retries, circuit breaking and logging without touching backends.
+//
+//	repo := middleware.Wrap(postgresql.New(db, "es_events"),
+//		middleware.Logging(logger),
+//		middleware.CircuitBreaker(5, 10*time.Second),
+//		middleware.Retry(middleware.RetryPolicy{Attempts: 3, Backoff: 50 * time.Millisecond}),
+//		middleware.Timeout(time.Second),
+//	)
+package middleware
+
+import (
+	"context"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+)
+
+// Op describes intercepted repository call.
+type Op struct {
+	// Method is name of the called repository method, e.g. "Save".
+	Method string
+	// AggregateId and AggregateType are empty for calls spanning several
+	// streams.
+	AggregateId   string
+	AggregateType string
+}
+
+// Handler performs repository call.
+type Handler func(ctx context.Context, op Op) error
+
+// Middleware decorates repository calls, it calls next to proceed.
+type Middleware func(next Handler) Handler
+
+// Chain composes middlewares into one, the first middleware is the
+// outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+type repository struct {
+	repo       eventstore.Repository
+	middleware Middleware
+}
+
+var (
+	_ (eventstore.Repository)      = &repository{}
+	_ (eventstore.MultiSaver)      = &repository{}
+	_ (eventstore.IdempotentSaver) = &repository{}
+	_ (eventstore.Verifier)        = &repository{}
+	_ (eventstore.StreamDeleter)   = &repository{}
+	_ (eventstore.Archiver)        = &repository{}
+	_ (eventstore.Truncater)       = &repository{}
+)
+
+// Wrap decorates every call of repo with middlewares, the first middleware
+// is the outermost. Optional interfaces, e.g. eventstore.MultiSaver or
+// eventstore.Archiver, are always implemented, their methods return
+// eventstore.ErrNotSupported if repo doesn't implement them.
+func Wrap(repo eventstore.Repository, middlewares ...Middleware) *repository {
+	return &repository{repo: repo, middleware: Chain(middlewares...)}
+}
+
+func (r *repository) call(ctx context.Context, op Op, fn func(ctx context.Context) error) error {
+	handler := r.middleware(func(ctx context.Context, op Op) error {
+		return fn(ctx)
+	})
+	return handler(ctx, op)
+}
+
+func (r *repository) Get(ctx context.Context, aggregateID, aggregateType string, version event.Version) (event.Eventer, error) {
+	var evt event.Eventer
+	err := r.call(ctx, Op{Method: "Get", AggregateId: aggregateID, AggregateType: aggregateType}, func(ctx context.Context) error {
+		var err error
+		evt, err = r.repo.Get(ctx, aggregateID, aggregateType, version)
+		return err
+	})
+	return evt, err
+}
+
+func (r *repository) List(ctx context.Context, aggregateID, aggregateType string, filter *eventstore.ListFilter) ([]event.Eventer, error) {
+	var events []event.Eventer
+	err := r.call(ctx, Op{Method: "List", AggregateId: aggregateID, AggregateType: aggregateType}, func(ctx context.Context) error {
+		var err error
+		events, err = r.repo.List(ctx, aggregateID, aggregateType, filter)
+		return err
+	})
+	return events, err
+}
+
+func (r *repository) Save(ctx context.Context, events []event.Eventer) error {
+	return r.call(ctx, streamOp("Save", events), func(ctx context.Context) error {
+		return r.repo.Save(ctx, events)
+	})
+}
+
+func (r *repository) SaveMulti(ctx context.Context, streams [][]event.Eventer) error {
+	saver, ok := r.repo.(eventstore.MultiSaver)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return r.call(ctx, Op{Method: "SaveMulti"}, func(ctx context.Context) error {
+		return saver.SaveMulti(ctx, streams)
+	})
+}
+
+func (r *repository) SaveIdempotent(ctx context.Context, events []event.Eventer) (bool, error) {
+	saver, ok := r.repo.(eventstore.IdempotentSaver)
+	if !ok {
+		return false, eventstore.ErrNotSupported
+	}
+
+	var replayed bool
+	err := r.call(ctx, streamOp("SaveIdempotent", events), func(ctx context.Context) error {
+		var err error
+		replayed, err = saver.SaveIdempotent(ctx, events)
+		return err
+	})
+	return replayed, err
+}
+
+func (r *repository) Verify(ctx context.Context, aggregateID, aggregateType string) error {
+	verifier, ok := r.repo.(eventstore.Verifier)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return r.call(ctx, Op{Method: "Verify", AggregateId: aggregateID, AggregateType: aggregateType}, func(ctx context.Context) error {
+		return verifier.Verify(ctx, aggregateID, aggregateType)
+	})
+}
+
+func (r *repository) SoftDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	deleter, ok := r.repo.(eventstore.StreamDeleter)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return r.call(ctx, Op{Method: "SoftDelete", AggregateId: aggregateID, AggregateType: aggregateType}, func(ctx context.Context) error {
+		return deleter.SoftDelete(ctx, aggregateID, aggregateType)
+	})
+}
+
+func (r *repository) HardDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	deleter, ok := r.repo.(eventstore.StreamDeleter)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return r.call(ctx, Op{Method: "HardDelete", AggregateId: aggregateID, AggregateType: aggregateType}, func(ctx context.Context) error {
+		return deleter.HardDelete(ctx, aggregateID, aggregateType)
+	})
+}
+
+func (r *repository) Archive(ctx context.Context, aggregateID, aggregateType string) error {
+	archiver, ok := r.repo.(eventstore.Archiver)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return r.call(ctx, Op{Method: "Archive", AggregateId: aggregateID, AggregateType: aggregateType}, func(ctx context.Context) error {
+		return archiver.Archive(ctx, aggregateID, aggregateType)
+	})
+}
+
+func (r *repository) TruncateBefore(ctx context.Context, aggregateID, aggregateType string, version event.Version) error {
+	truncater, ok := r.repo.(eventstore.Truncater)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return r.call(ctx, Op{Method: "TruncateBefore", AggregateId: aggregateID, AggregateType: aggregateType}, func(ctx context.Context) error {
+		return truncater.TruncateBefore(ctx, aggregateID, aggregateType, version)
+	})
+}
+
+func streamOp(method string, events []event.Eventer) Op {
+	op := Op{Method: method}
+	if len(events) != 0 {
+		op.AggregateId = events[0].GetAggregateId()
+		op.AggregateType = events[0].GetAggregateType()
+	}
+	return op
+}
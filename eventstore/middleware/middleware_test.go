@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/memory"
+)
+
+// flakyRepository fails the first failures calls of Save with
+// driver.ErrBadConn.
+type flakyRepository struct {
+	eventstore.Repository
+	failures int
+	calls    int
+}
+
+func (r *flakyRepository) Save(ctx context.Context, events []event.Eventer) error {
+	r.calls++
+	if r.calls <= r.failures {
+		return driver.ErrBadConn
+	}
+	return r.Repository.Save(ctx, events)
+}
+
+func newTestEvent(aggregateId string, version event.Version) event.Eventer {
+	evt := event.MustNew("created", struct{ Status string }{Status: "created"})
+	evt.SetAggregateId(aggregateId)
+	evt.SetAggregateType("TestAggregator")
+	evt.SetVersion(version)
+	return evt
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, op Op) error {
+				calls = append(calls, name+":"+op.Method)
+				return next(ctx, op)
+			}
+		}
+	}
+
+	repo := Wrap(memory.New(), trace("outer"), trace("inner"))
+	err := repo.Save(context.TODO(), []event.Eventer{newTestEvent("agg_0", 1)})
+	assert.NoError(t, err, "failed to save events")
+	assert.Equal(t, []string{"outer:Save", "inner:Save"}, calls)
+
+	replayed, err := repo.SaveIdempotent(context.TODO(), []event.Eventer{newTestEvent("agg_0", 2)})
+	assert.NoError(t, err, "failed to save events")
+	assert.False(t, replayed)
+}
+
+func TestTimeout(t *testing.T) {
+	var deadline bool
+	probe := func(next Handler) Handler {
+		return func(ctx context.Context, op Op) error {
+			_, deadline = ctx.Deadline()
+			return next(ctx, op)
+		}
+	}
+
+	repo := Wrap(memory.New(), Timeout(time.Second), probe)
+	_, err := repo.List(context.TODO(), "agg_0", "TestAggregator", nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.True(t, deadline, "call must have deadline")
+}
+
+func TestRetry(t *testing.T) {
+	flaky := &flakyRepository{Repository: memory.New(), failures: 2}
+	repo := Wrap(flaky, Retry(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}))
+
+	err := repo.Save(context.TODO(), []event.Eventer{newTestEvent("agg_0", 1)})
+	assert.NoError(t, err, "save must succeed after retries")
+	assert.Equal(t, 3, flaky.calls)
+
+	// Domain errors are not retried
+	err = repo.Save(context.TODO(), []event.Eventer{newTestEvent("agg_0", 1)})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	assert.Equal(t, 4, flaky.calls)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	flaky := &flakyRepository{Repository: memory.New(), failures: 2}
+	repo := Wrap(flaky, CircuitBreaker(2, 10*time.Millisecond))
+	ctx := context.TODO()
+
+	for i := 0; i < 2; i++ {
+		err := repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1)})
+		assert.Equal(t, driver.ErrBadConn, err)
+	}
+	err := repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1)})
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 2, flaky.calls, "open circuit must not call repository")
+
+	time.Sleep(20 * time.Millisecond)
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1)})
+	assert.NoError(t, err, "trial call must close circuit")
+	err = repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 2)})
+	assert.NoError(t, err, "closed circuit must call repository")
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := Wrap(memory.New(), Logging(logger))
+
+	_, err := repo.Get(context.TODO(), "agg_0", "TestAggregator", 1)
+	assert.Equal(t, eventstore.ErrEventNotFound, err)
+	assert.Contains(t, buf.String(), "level=DEBUG")
+	assert.NotContains(t, buf.String(), "level=ERROR")
+	assert.Contains(t, buf.String(), "method=Get")
+	assert.Contains(t, buf.String(), "aggregate_id=agg_0")
+
+	buf.Reset()
+	err = repo.Save(context.TODO(), []event.Eventer{newTestEvent("agg_0", 2)})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+	assert.Contains(t, buf.String(), "level=ERROR")
+	assert.Contains(t, buf.String(), "method=Save")
+}
+
+func TestCircuitBreakerSingleTrial(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: time.Millisecond}
+
+	// Call let through while the circuit was closed
+	allowed, trial := b.allow()
+	assert.True(t, allowed)
+	assert.False(t, trial)
+
+	b.record(false, true)
+	time.Sleep(2 * time.Millisecond)
+	allowed, trial = b.allow()
+	assert.True(t, allowed)
+	assert.True(t, trial)
+
+	// Late failure of a non-trial call must not start another trial
+	b.record(false, true)
+	time.Sleep(2 * time.Millisecond)
+	allowed, _ = b.allow()
+	assert.False(t, allowed, "only one trial call may be in flight")
+
+	b.record(true, false)
+	allowed, _ = b.allow()
+	assert.True(t, allowed, "successful trial must close circuit")
+}
+
+func TestCircuitBreakerTrialPanics(t *testing.T) {
+	var panics bool
+	handler := CircuitBreaker(1, time.Millisecond)(func(ctx context.Context, op Op) error {
+		if panics {
+			panic("trial call panics")
+		}
+		return driver.ErrBadConn
+	})
+	ctx := context.TODO()
+
+	assert.Equal(t, driver.ErrBadConn, handler(ctx, Op{Method: "Save"}))
+	time.Sleep(2 * time.Millisecond)
+	panics = true
+	assert.Panics(t, func() { handler(ctx, Op{Method: "Save"}) })
+
+	assert.Equal(t, ErrCircuitOpen, handler(ctx, Op{Method: "Save"}), "panicking trial must reopen circuit")
+	time.Sleep(2 * time.Millisecond)
+	panics = false
+	assert.Equal(t, driver.ErrBadConn, handler(ctx, Op{Method: "Save"}), "next trial must be let through")
+}
+
+func TestWrapOptionalInterfaces(t *testing.T) {
+	ctx := context.TODO()
+	var methods []string
+	probe := func(next Handler) Handler {
+		return func(ctx context.Context, op Op) error {
+			methods = append(methods, op.Method)
+			return next(ctx, op)
+		}
+	}
+
+	repo := Wrap(memory.New(), probe)
+	err := repo.Save(ctx, []event.Eventer{newTestEvent("agg_0", 1), newTestEvent("agg_0", 2)})
+	assert.NoError(t, err, "failed to save events")
+	assert.NoError(t, repo.Verify(ctx, "agg_0", "TestAggregator"))
+	assert.NoError(t, repo.TruncateBefore(ctx, "agg_0", "TestAggregator", 2))
+	assert.NoError(t, repo.SoftDelete(ctx, "agg_0", "TestAggregator"))
+	assert.NoError(t, repo.HardDelete(ctx, "agg_0", "TestAggregator"))
+	assert.Equal(t, []string{"Save", "Verify", "TruncateBefore", "SoftDelete", "HardDelete"}, methods)
+
+	// flakyRepository implements none of the optional interfaces
+	repo = Wrap(&flakyRepository{Repository: memory.New()})
+	assert.Equal(t, eventstore.ErrNotSupported, repo.Archive(ctx, "agg_0", "TestAggregator"))
+	assert.Equal(t, eventstore.ErrNotSupported, repo.Verify(ctx, "agg_0", "TestAggregator"))
+}
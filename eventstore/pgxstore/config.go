@@ -0,0 +1,42 @@
+package pgxstore
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+// Config describes layout of the event table, it's the same as Config of the
+// postgresql store. Schema, table and column names are quoted, so they are
+// case sensitive.
+type Config = pgschema.Config
+
+// Columns are names of the event table columns, empty names are defaulted
+// to names used by CreateMigrations.
+type Columns = pgschema.Columns
+
+// PayloadType is type of the payload column.
+type PayloadType = pgschema.PayloadType
+
+const (
+	PayloadBytea = pgschema.PayloadBytea
+	// PayloadJSONB stores payloads as JSONB, so payload fields can be
+	// queried with SQL. Only JSON serialized events can be saved.
+	PayloadJSONB = pgschema.PayloadJSONB
+)
+
+var (
+	ErrPayloadNotJSON   = pgschema.ErrPayloadNotJSON
+	ErrInvalidTableName = pgschema.ErrInvalidTableName
+)
+
+// NewWithConfig returns repository for the event table described by config.
+func NewWithConfig(pool *pgxpool.Pool, cfg Config, opts ...Option) *eventRepository {
+	db := poolDB{pool: pool, copyColumns: cfg.WithDefaults().Columns.WriteColumns()}
+	r := &eventRepository{Store: pgstore.New(db, pgxDriver{}, cfg), pool: pool}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
@@ -0,0 +1,121 @@
+package pgxstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+// poolDB adapts *pgxpool.Pool to the shared store.
+type poolDB struct {
+	pool *pgxpool.Pool
+	// copyColumns are unquoted names of columns written by COPY.
+	copyColumns []string
+}
+
+func (d poolDB) Begin(ctx context.Context, readOnly bool) (pgstore.Tx, error) {
+	opts := pgx.TxOptions{}
+	if readOnly {
+		opts.AccessMode = pgx.ReadOnly
+	}
+	tx, err := d.pool.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return poolTx{tx: tx, copyColumns: d.copyColumns}, nil
+}
+
+func (d poolDB) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	tag, err := d.pool.Exec(ctx, query, args...)
+	return tag.RowsAffected(), err
+}
+
+func (d poolDB) Query(ctx context.Context, query string, args ...interface{}) (pgstore.Rows, error) {
+	return d.pool.Query(ctx, query, args...)
+}
+
+func (d poolDB) QueryRow(ctx context.Context, query string, args ...interface{}) pgstore.Row {
+	return row{d.pool.QueryRow(ctx, query, args...)}
+}
+
+// poolTx adapts pgx.Tx to the shared store, batches of events are inserted
+// with COPY.
+type poolTx struct {
+	tx          pgx.Tx
+	copyColumns []string
+}
+
+var _ (pgstore.Copier) = poolTx{}
+
+func (t poolTx) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	tag, err := t.tx.Exec(ctx, query, args...)
+	return tag.RowsAffected(), err
+}
+
+func (t poolTx) Query(ctx context.Context, query string, args ...interface{}) (pgstore.Rows, error) {
+	return t.tx.Query(ctx, query, args...)
+}
+
+func (t poolTx) QueryRow(ctx context.Context, query string, args ...interface{}) pgstore.Row {
+	return row{t.tx.QueryRow(ctx, query, args...)}
+}
+
+func (t poolTx) Commit(ctx context.Context) error {
+	return t.tx.Commit(ctx)
+}
+
+func (t poolTx) Rollback(ctx context.Context) error {
+	err := t.tx.Rollback(ctx)
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return sql.ErrTxDone
+	}
+	return err
+}
+
+func (t poolTx) CopyFrom(ctx context.Context, table pgschema.Table, rows [][]interface{}) error {
+	_, err := t.tx.CopyFrom(ctx, copyTable(table), t.copyColumns, pgx.CopyFromRows(rows))
+	return err
+}
+
+// copyTable returns identifier of the event table for COPY.
+func copyTable(table pgschema.Table) pgx.Identifier {
+	if table.Schema == "" {
+		return pgx.Identifier{table.Name}
+	}
+	return pgx.Identifier{table.Schema, table.Name}
+}
+
+// row reports pgx.ErrNoRows as sql.ErrNoRows.
+type row struct {
+	pgx.Row
+}
+
+func (r row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// pgxDriver maps errors of pgx, arrays are encoded by pgx itself.
+type pgxDriver struct{}
+
+func (pgxDriver) Array(v interface{}) interface{} {
+	return v
+}
+
+func (pgxDriver) ErrorCode(err error) (code, constraint string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code, pgErr.ConstraintName
+	}
+	return "", ""
+}
@@ -0,0 +1,43 @@
+package pgxstore
+
+import (
+	"context"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+// ErrLockTimeout is returned when the stream lock isn't acquired within the
+// lock timeout, or can't be acquired under the lock of another stream
+// without risking a deadlock.
+var ErrLockTimeout = eventstore.ErrLockTimeout
+
+// ErrForeignLock is returned when the context holds the stream lock taken
+// by another repository, even of the same database.
+var ErrForeignLock = pgstore.ErrForeignLock
+
+// StreamLock holds the advisory lock of the stream, see Lock.
+type StreamLock = pgstore.StreamLock
+
+// Lock begins transaction which holds the advisory lock of the stream. Reads
+// and saves with the returned context are performed in the transaction, so
+// the caller can load aggregate, apply events and save them without
+// conflicting with other writers. Writers of the repository created
+// WithAdvisoryLocks option wait for the lock and then fail with
+// ErrControlConcurrency if they saved stale versions, others fail on save
+// as usual. Other streams saved under the lock are locked as well, streams
+// sorted before the locked one fail with ErrLockTimeout if already locked.
+//
+//	ctx, lock, err := repo.Lock(ctx, aggregateId, aggregateType)
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Release(ctx)
+//	...
+//	if err := repo.Save(ctx, events); err != nil {
+//		return err
+//	}
+//	return lock.Commit(ctx)
+func (r *eventRepository) Lock(ctx context.Context, aggregateID, aggregateType string) (context.Context, *StreamLock, error) {
+	return r.Store.Lock(ctx, aggregateID, aggregateType)
+}
@@ -0,0 +1,77 @@
+package pgxstore
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// CreateMigrations create the event table described by config. Migrations
+// are the same as of the postgresql store, so both stores can be used with
+// one database.
+func CreateMigrations(cfg Config) []string {
+	return pgschema.CreateMigrations(cfg)
+}
+
+// UpgradeMigrations upgrade the event table created by earlier releases to
+// the layout of CreateMigrations. Statements are idempotent, existing
+// events are left without hashes and aren't verified.
+func UpgradeMigrations(cfg Config) []string {
+	return pgschema.UpgradeMigrations(cfg)
+}
+
+// TimePartitionMigrations are used instead of CreateMigrations, they create
+// the event table partitioned by month of the event timestamp with partitions
+// of the current and the next month. Further partitions are created ahead by
+// Partitioner. Stream versions and idempotency keys are kept unique by the
+// repository created WithTimePartitions option.
+func TimePartitionMigrations(cfg Config) []string {
+	return pgschema.TimePartitionMigrations(cfg)
+}
+
+// HashPartitionMigrations are used instead of CreateMigrations, they create
+// the event table partitioned by hash of the aggregate id. Idempotency keys
+// are kept unique per tenant by the repository created WithHashPartitions
+// option.
+func HashPartitionMigrations(cfg Config, partitions int) []string {
+	return pgschema.HashPartitionMigrations(cfg, partitions)
+}
+
+// ArchiveMigrations are optional, archive table is required by WithArchive
+// option and has the same structure as the event table.
+func ArchiveMigrations(cfg Config) []string {
+	return pgschema.ArchiveMigrations(cfg)
+}
+
+// TruncationMigrations are optional, streams table is required by
+// WithTruncation option.
+func TruncationMigrations(cfg Config) []string {
+	return pgschema.TruncationMigrations(cfg)
+}
+
+// RowLevelSecurityMigrations are optional, they forbid access to rows of
+// other tenants on the database level. The repository should be created
+// WithRowLevelSecurity option, migrations are applied after
+// ArchiveMigrations and TruncationMigrations.
+func RowLevelSecurityMigrations(cfg Config) []string {
+	return pgschema.RowLevelSecurityMigrations(cfg)
+}
+
+// Migrate executes migration statements in one transaction.
+func Migrate(ctx context.Context, pool *pgxpool.Pool, stmts []string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
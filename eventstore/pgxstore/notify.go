@@ -0,0 +1,74 @@
+package pgxstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+// Notification is published for every saved stream, Version is the version
+// of the last saved event.
+type Notification struct {
+	TenantId      string        `json:"tenant_id"`
+	AggregateId   string        `json:"aggregate_id"`
+	AggregateType string        `json:"aggregate_type"`
+	Version       event.Version `json:"version"`
+}
+
+// notify publishes notification about saved events, it's delivered to
+// listeners when transaction is committed.
+func (r *eventRepository) notify(ctx context.Context, tx pgstore.Tx, events []event.Eventer) error {
+	last := events[len(events)-1]
+	payload, err := json.Marshal(Notification{
+		TenantId:      last.GetTenantId(),
+		AggregateId:   last.GetAggregateId(),
+		AggregateType: last.GetAggregateType(),
+		Version:       last.GetVersion(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "SELECT pg_notify($1, $2)", r.channel, string(payload))
+	return err
+}
+
+// Listen calls handler for every notification until context is done or
+// handler fails. Repository should be created WithNotify option.
+func (r *eventRepository) Listen(ctx context.Context, handler func(Notification) error) error {
+	if r.channel == "" {
+		return eventstore.ErrNotSupported
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// Listening connection is never returned into the pool
+	pgconn := conn.Hijack()
+	defer pgconn.Close(context.Background())
+
+	if _, err := pgconn.Exec(ctx, "LISTEN "+pgx.Identifier{r.channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		n, err := pgconn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var notification Notification
+		if err := json.Unmarshal([]byte(n.Payload), &notification); err != nil {
+			return err
+		}
+		if err := handler(notification); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package pgxstore
+
+import "github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+
+// Partitioner creates monthly partitions of the event table partitioned by
+// time (see TimePartitionMigrations). Events out of created partitions go to
+// the DEFAULT partition, so partitions are created ahead of time.
+type Partitioner = pgstore.Partitioner
+
+// NewPartitioner returns partitioner which keeps partitions for the current
+// month and the given number of months ahead.
+func NewPartitioner(repo *eventRepository, ahead int) *Partitioner {
+	return pgstore.NewPartitioner(repo.Store, ahead)
+}
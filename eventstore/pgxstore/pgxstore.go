@@ -0,0 +1,39 @@
+// Package pgxstore is PostgreSQL event store built on pgx. It uses the same
+// table layout as the postgresql store, but talks binary protocol through
+// the pgxpool, inserts batches of events with COPY and publishes
+// notifications about saved streams with LISTEN/NOTIFY.
+package pgxstore
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+type eventRepository struct {
+	*pgstore.Store
+	pool *pgxpool.Pool
+	// channel of notifications, empty unless WithNotify.
+	channel string
+}
+
+var (
+	_ (eventstore.Repository)      = &eventRepository{}
+	_ (eventstore.MultiSaver)      = &eventRepository{}
+	_ (eventstore.IdempotentSaver) = &eventRepository{}
+	_ (eventstore.Verifier)        = &eventRepository{}
+	_ (eventstore.StreamDeleter)   = &eventRepository{}
+	_ (eventstore.Archiver)        = &eventRepository{}
+	_ (eventstore.Truncater)       = &eventRepository{}
+)
+
+// New returns repository for the event table created with the default
+// layout, table name may be schema qualified, e.g. "public.es_events".
+func New(pool *pgxpool.Pool, tableName string, opts ...Option) *eventRepository {
+	table := pgschema.TableOf(tableName)
+	return NewWithConfig(pool, Config{Schema: table.Schema, Table: table.Name}, opts...)
+}
+
+var ErrControlConcurrency = eventstore.ErrControlConcurrency
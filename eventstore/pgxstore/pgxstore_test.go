@@ -0,0 +1,218 @@
+package pgxstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgtest"
+)
+
+var (
+	pool     *pgxpool.Pool
+	poolPort string
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Run(m, pgtest.Setup{
+		Connect: func(port string) error {
+			var err error
+			poolPort = port
+			pool, err = pgxpool.New(context.Background(), pgtest.DSN(port, "root", "root", "test"))
+			if err != nil {
+				return err
+			}
+			return pool.Ping(context.Background())
+		},
+		Migrate: func() error {
+			cfg := Config{Schema: "public", Table: "es_events"}
+			for _, stmts := range [][]string{
+				CreateMigrations(cfg),
+				ArchiveMigrations(cfg),
+				TruncationMigrations(cfg),
+			} {
+				if err := Migrate(context.Background(), pool, stmts); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func TestSuite(t *testing.T) {
+	pgtest.RunSuite(t, pgtest.Store{Port: poolPort, New: newSuiteRepository})
+}
+
+// newSuiteRepository returns repository of the config adapted to the shared
+// suite of the PostgreSQL stores.
+func newSuiteRepository(t *testing.T, cfg Config, opts pgtest.Options) pgtest.Repository {
+	conn := pool
+	if opts.User != "" {
+		conn = openSuitePool(t, pgtest.DSN(poolPort, opts.User, opts.Password, "test"))
+	}
+
+	var options []Option
+	if opts.Replica != "" {
+		options = append(options, WithReadReplica(openSuitePool(t, pgtest.DSN(poolPort, "root", "root", opts.Replica))))
+	}
+	if opts.TenantTables != nil {
+		options = append(options, WithTenantTables(opts.TenantTables))
+	}
+	if opts.RowLevelSecurity {
+		options = append(options, WithRowLevelSecurity())
+	}
+	if opts.Archive {
+		options = append(options, WithArchive())
+	}
+	if opts.Truncation {
+		options = append(options, WithTruncation())
+	}
+	if opts.TimePartitions {
+		options = append(options, WithTimePartitions())
+	}
+	if opts.HashPartitions {
+		options = append(options, WithHashPartitions())
+	}
+	if opts.AdvisoryLocks {
+		options = append(options, WithAdvisoryLocks(opts.LockTimeout))
+	}
+	if opts.Signer != nil {
+		options = append(options, WithSigner(opts.Signer))
+	}
+	if opts.Verifier != nil {
+		options = append(options, WithSignatureVerifier(opts.Verifier, opts.StrictSignatures))
+	}
+	if opts.Logger != nil {
+		options = append(options, WithLogger(opts.Logger))
+	}
+	return suiteRepository{NewWithConfig(conn, cfg, options...)}
+}
+
+func openSuitePool(t *testing.T, dsn string) *pgxpool.Pool {
+	conn, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %s", err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+type suiteRepository struct {
+	*eventRepository
+}
+
+func (r suiteRepository) Lock(ctx context.Context, aggregateID, aggregateType string) (context.Context, pgtest.StreamLock, error) {
+	lockCtx, lock, err := r.eventRepository.Lock(ctx, aggregateID, aggregateType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lockCtx, lock, nil
+}
+
+func (r suiteRepository) EnsurePartitions(ctx context.Context, ahead int) error {
+	return NewPartitioner(r.eventRepository, ahead).EnsurePartitions(ctx)
+}
+
+func (r suiteRepository) Scavenge(ctx context.Context, batchSize int) (int64, error) {
+	return NewScavenger(r.eventRepository, batchSize).Scavenge(ctx)
+}
+
+func (r suiteRepository) Compactor(batchSize int, rules ...RetentionRule) pgtest.Compactor {
+	return NewCompactor(r.eventRepository, batchSize, rules...)
+}
+
+func TestSaveBatch(t *testing.T) {
+	agg := &pgtest.TestAggregator{}
+	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+
+	ctx := context.TODO()
+	repo := New(pool, "es_events")
+
+	events := make([]*event.Event, 100)
+	for i := range events {
+		events[i] = event.MustNew("confirmed", pgtest.Confirmed{Status: "Confirmed"})
+		events[i].SetMetadata(event.Metadata{"batch": "copy"})
+		err := root.Apply(events[i])
+		assert.NoError(t, err, "failed to apply")
+	}
+
+	err := repo.Save(ctx, event.Covarience(events))
+	assert.NoError(t, err, "failed to copy events")
+
+	listEvents, err := repo.List(ctx, root.GetId(), root.GetType(), nil)
+	assert.NoError(t, err, "failed to get list of events")
+	assert.Equal(t, len(events), len(listEvents))
+	assert.Equal(t, "copy", listEvents[0].GetMetadata()["batch"])
+	assert.NoError(t, repo.Verify(ctx, root.GetId(), root.GetType()))
+
+	// Copied batch is checked by unique index as well
+	err = repo.Save(ctx, event.Covarience(events))
+	assert.ErrorIs(t, err, ErrControlConcurrency)
+}
+
+func TestListen(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	repo := New(pool, "es_events", WithNotify("es_events_saved"))
+	notifications := make(chan Notification, 16)
+	go repo.Listen(ctx, func(n Notification) error {
+		notifications <- n
+		return nil
+	})
+
+	// Listener may subscribe after the first saves, so streams are saved
+	// until notification is received
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	saved := make(map[string]event.Version)
+	for {
+		select {
+		case n := <-notifications:
+			version, ok := saved[n.AggregateId]
+			assert.True(t, ok, "notification must be published for saved stream")
+			assert.Equal(t, version, n.Version)
+			return
+		case <-ticker.C:
+			agg := &pgtest.TestAggregator{}
+			root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+			events, err := pgtest.SeedEvents(root, repo)
+			assert.NoError(t, err, "cannot seed events")
+			saved[root.GetId()] = events[1].GetVersion()
+		case <-ctx.Done():
+			t.Fatal("notification is not received")
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	code, constraint := pgxDriver{}.ErrorCode(fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: "id_type_version_un"}))
+	assert.Equal(t, "23505", code)
+	assert.Equal(t, "id_type_version_un", constraint)
+
+	code, _ = pgxDriver{}.ErrorCode(pgx.ErrNoRows)
+	assert.Equal(t, "", code, "errors of pgx have no code")
+}
+
+func TestNoRows(t *testing.T) {
+	ctx := context.TODO()
+	var version int16
+	err := poolDB{pool: pool}.QueryRow(ctx, "SELECT version FROM es_events WHERE false").Scan(&version)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	tx, err := poolDB{pool: pool}.Begin(ctx, false)
+	assert.NoError(t, err, "failed to begin")
+	assert.NoError(t, tx.Commit(ctx), "failed to commit")
+	assert.Equal(t, sql.ErrTxDone, tx.Rollback(ctx))
+}
@@ -0,0 +1,27 @@
+package pgxstore
+
+import (
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+// RetentionRule limits how long events of the aggregate type are kept. Zero
+// MaxAge or MaxCount means no limit. The last event of the stream is always
+// kept, so appends continue the stream version. Rule with AggregateId applies
+// to the stream only and overrides rules of its aggregate type, stream rule
+// without limits keeps events of the stream forever.
+type RetentionRule = pgschema.RetentionRule
+
+// Retention describes events of the stream removed by retention rules.
+type Retention = pgschema.Retention
+
+// Compactor enforces retention rules. Streams are truncated with the
+// retention point and truncated events are deleted by Scavenger, so the
+// repository should be created WithTruncation option. Compactor handles the
+// event table of the context tenant, with WithTenantTables option it should
+// be run for every tenant, see eventstore.WithTenant.
+type Compactor = pgstore.Compactor
+
+func NewCompactor(repo *eventRepository, batchSize int, rules ...RetentionRule) *Compactor {
+	return pgstore.NewCompactor(repo.Store, batchSize, rules...)
+}
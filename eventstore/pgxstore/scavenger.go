@@ -0,0 +1,16 @@
+package pgxstore
+
+import "github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+
+// Scavenger physically deletes events hidden by TruncateBefore. The newest
+// event of the stream is always kept, so deleted streams keep their
+// tombstones and versions continue from the last one. Events are deleted in
+// small batches, each batch in its own transaction, so appends are never
+// blocked for long. If repository is created WithArchive option,
+// truncated events are moved into the archive table instead. Like Compactor,
+// Scavenger handles the event table of the context tenant.
+type Scavenger = pgstore.Scavenger
+
+func NewScavenger(repo *eventRepository, batchSize int) *Scavenger {
+	return pgstore.NewScavenger(repo.Store, batchSize)
+}
@@ -0,0 +1,99 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgstore"
+)
+
+// sqlDB adapts *sql.DB to the shared store.
+type sqlDB struct {
+	conn *sql.DB
+}
+
+func (d sqlDB) Begin(ctx context.Context, readOnly bool) (pgstore.Tx, error) {
+	tx, err := d.conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly})
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{tx}, nil
+}
+
+func (d sqlDB) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return exec(d.conn.ExecContext(ctx, query, args...))
+}
+
+func (d sqlDB) Query(ctx context.Context, query string, args ...interface{}) (pgstore.Rows, error) {
+	return queryRows(d.conn.QueryContext(ctx, query, args...))
+}
+
+func (d sqlDB) QueryRow(ctx context.Context, query string, args ...interface{}) pgstore.Row {
+	return d.conn.QueryRowContext(ctx, query, args...)
+}
+
+// sqlTx adapts *sql.Tx to the shared store.
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (t sqlTx) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return exec(t.tx.ExecContext(ctx, query, args...))
+}
+
+func (t sqlTx) Query(ctx context.Context, query string, args ...interface{}) (pgstore.Rows, error) {
+	return queryRows(t.tx.QueryContext(ctx, query, args...))
+}
+
+func (t sqlTx) QueryRow(ctx context.Context, query string, args ...interface{}) pgstore.Row {
+	return t.tx.QueryRowContext(ctx, query, args...)
+}
+
+func (t sqlTx) Commit(context.Context) error {
+	return t.tx.Commit()
+}
+
+func (t sqlTx) Rollback(context.Context) error {
+	return t.tx.Rollback()
+}
+
+func exec(res sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sqlRows adapts *sql.Rows to the shared store.
+type sqlRows struct {
+	*sql.Rows
+}
+
+func (r sqlRows) Close() {
+	r.Rows.Close()
+}
+
+func queryRows(rows *sql.Rows, err error) (pgstore.Rows, error) {
+	if err != nil {
+		return nil, err
+	}
+	return sqlRows{rows}, nil
+}
+
+// pqDriver maps arrays and errors of lib/pq.
+type pqDriver struct{}
+
+func (pqDriver) Array(v interface{}) interface{} {
+	return pq.Array(v)
+}
+
+func (pqDriver) ErrorCode(err error) (code, constraint string) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code), pqErr.Constraint
+	}
+	return "", ""
+}
@@ -0,0 +1,102 @@
+package postgresql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"io"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// SubjectKeyMigrations create the table of subject keys used by
+// NewSubjectKeyStore. Table name may be schema qualified, names which are not
+// plain identifiers are rejected with ErrInvalidTableName.
+func SubjectKeyMigrations(tableName string) ([]string, error) {
+	table, err := pgschema.ParseTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		`CREATE TABLE ` + table.String() + ` (
+		subject     VARCHAR(128) NOT NULL PRIMARY KEY,
+		key         bytea,
+		shredded_at TIMESTAMPTZ
+	);`,
+	}, nil
+}
+
+// subjectKeyRepository stores per-subject data keys used for crypto-shredding.
+// Deleted keys are kept as rows with NULL key, so they are never recreated.
+type subjectKeyRepository struct {
+	tableName pgschema.Table
+	conn      *sql.DB
+}
+
+var _ (event.SubjectKeyStore) = &subjectKeyRepository{}
+
+// NewSubjectKeyStore returns store of the table created by
+// SubjectKeyMigrations, table name may be schema qualified.
+func NewSubjectKeyStore(conn *sql.DB, tableName string) *subjectKeyRepository {
+	return &subjectKeyRepository{tableName: pgschema.TableOf(tableName), conn: conn}
+}
+
+func (r *subjectKeyRepository) CreateKey(ctx context.Context, subject string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	ib := sqlbuilder.PostgreSQL.
+		NewInsertBuilder().
+		InsertInto(r.tableName.String()).
+		Cols("subject", "key").
+		Values(subject, key)
+	ib.SQL("ON CONFLICT (subject) DO NOTHING")
+
+	q, args := ib.Build()
+	if _, err := r.conn.ExecContext(ctx, q, args...); err != nil {
+		return nil, err
+	}
+
+	// Concurrent writer might create the key first
+	return r.Key(ctx, subject)
+}
+
+func (r *subjectKeyRepository) Key(ctx context.Context, subject string) ([]byte, error) {
+	sb := sqlbuilder.PostgreSQL.
+		NewSelectBuilder().
+		Select("key").
+		From(r.tableName.String())
+	sb = sb.Where(sb.Equal("subject", subject))
+
+	q, args := sb.Build()
+
+	var key []byte
+	if err := r.conn.QueryRowContext(ctx, q, args...).Scan(&key); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, event.ErrDataShredded
+		}
+		return nil, err
+	}
+	if key == nil {
+		return nil, event.ErrDataShredded
+	}
+	return key, nil
+}
+
+func (r *subjectKeyRepository) Delete(ctx context.Context, subject string) error {
+	ib := sqlbuilder.PostgreSQL.
+		NewInsertBuilder().
+		InsertInto(r.tableName.String()).
+		Cols("subject", "key", "shredded_at").
+		Values(subject, nil, sqlbuilder.Raw("now()"))
+	ib.SQL("ON CONFLICT (subject) DO UPDATE SET key = NULL, shredded_at = now()")
+
+	q, args := ib.Build()
+	_, err := r.conn.ExecContext(ctx, q, args...)
+	return err
+}
@@ -1,30 +1,99 @@
 package postgresql
 
-import "context"
-
-var createMigrations = []string{
-	`CREATE TABLE public.es_events (
-		aggregate_id   VARCHAR(128) NOT NULL,
-		aggregate_type VARCHAR(128) NOT NULL,
-		reason         TEXT NOT NULL,
-		version        SMALLINT NOT NULL,
-		tstamp         TIMESTAMPTZ NOT NULL,
-		payload        bytea,
-		serializer     VARCHAR(16)
-	);`,
-	"CREATE UNIQUE INDEX id_type_version_un ON public.es_events (aggregate_id, aggregate_type, version);",
-	"CREATE INDEX id_type_idx ON public.es_events (aggregate_id, aggregate_type);",
+import (
+	"context"
+	"database/sql"
+
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgschema"
+)
+
+// CreateMigrations create the event table described by config, New(conn,
+// "es_events") expects the table created with Config{Table: "es_events"}.
+// JSONB payloads are indexed with GIN index, e.g. for containment queries:
+//
+//	SELECT * FROM es_events WHERE payload @> '{"status": "paid"}'
+func CreateMigrations(cfg Config) []string {
+	return pgschema.CreateMigrations(cfg)
+}
+
+// UpgradeMigrations upgrade the event table created by earlier releases to
+// the layout of CreateMigrations, e.g. the table without tenant, hash and
+// signature columns. Statements are idempotent. Existing events are left
+// without hashes, Verify checks the chain from the first event saved after
+// the upgrade.
+func UpgradeMigrations(cfg Config) []string {
+	return pgschema.UpgradeMigrations(cfg)
 }
 
+// TimePartitionMigrations are used instead of CreateMigrations, they create
+// the event table partitioned by month of the event timestamp with partitions
+// of the current and the next month. Further partitions are created ahead by
+// Partitioner, events out of them go to the default partition and are moved
+// once their partition is created. Unique indexes of the partitioned table have to contain the
+// timestamp, so stream versions and idempotency keys are kept unique by the
+// repository created WithTimePartitions option.
+func TimePartitionMigrations(cfg Config) []string {
+	return pgschema.TimePartitionMigrations(cfg)
+}
+
+// HashPartitionMigrations are used instead of CreateMigrations, they create
+// the event table partitioned by hash of the aggregate id. Every stream lives
+// in a single partition, so stream reads and appends touch one partition only.
+// Idempotency keys are kept unique per tenant by the repository created
+// WithHashPartitions option.
+func HashPartitionMigrations(cfg Config, partitions int) []string {
+	return pgschema.HashPartitionMigrations(cfg, partitions)
+}
+
+// ArchiveMigrations are optional, archive table is required by WithArchive
+// option and has the same structure as the event table.
+func ArchiveMigrations(cfg Config) []string {
+	return pgschema.ArchiveMigrations(cfg)
+}
+
+// TruncationMigrations are optional, streams table is required by
+// WithTruncation option.
+func TruncationMigrations(cfg Config) []string {
+	return pgschema.TruncationMigrations(cfg)
+}
+
+// RowLevelSecurityMigrations are optional, they forbid access to rows of
+// other tenants on the database level. The table owner is subjected to
+// policies as well, the repository should be created WithRowLevelSecurity
+// option. Archive and streams tables are protected as well, so migrations
+// are applied after ArchiveMigrations and TruncationMigrations.
+func RowLevelSecurityMigrations(cfg Config) []string {
+	return pgschema.RowLevelSecurityMigrations(cfg)
+}
+
+var createMigrations = CreateMigrations(Config{Schema: "public", Table: "es_events"})
+
 func (r *eventRepository) migrate(ctx context.Context, stmts []string) error {
-	tx, err := r.conn.BeginTx(ctx, nil)
+	tx, err := r.DB.Begin(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Migrate executes migration statements in one transaction.
+func Migrate(ctx context.Context, conn *sql.DB, stmts []string) error {
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		return nil
+		return err
 	}
 	defer tx.Rollback()
 
 	for _, stmt := range stmts {
-		if _, err := tx.Exec(stmt); err != nil {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+// Option configures eventRepository.
+type Option func(r *eventRepository)
+
+// WithSigner signs every saved event with signer.
+func WithSigner(signer event.Signer) Option {
+	return func(r *eventRepository) {
+		r.Signer = signer
+	}
+}
+
+// WithSignatureVerifier verifies signatures of every read event. Events with
+// invalid signature are rejected, in strict mode unsigned events are
+// rejected as well.
+func WithSignatureVerifier(verifier event.SignatureVerifier, strict bool) Option {
+	return func(r *eventRepository) {
+		r.Verifier = verifier
+		r.StrictSignatures = strict
+	}
+}
+
+// WithTenantTables routes events of every tenant into its own table. Router
+// returns table name for tenant id, it may be schema qualified to route
+// tenants into separate schemas, e.g. "tenant_a.es_events". Names may
+// contain only letters, digits and underscores, calls of tenants routed to
+// other names fail with ErrInvalidTableName.
+func WithTenantTables(router func(tenantId string) string) Option {
+	return func(r *eventRepository) {
+		r.TenantTable = router
+	}
+}
+
+// WithRowLevelSecurity scopes every transaction to the context tenant, so
+// row level security policies (see RowLevelSecurityMigrations) are applied.
+func WithRowLevelSecurity() Option {
+	return func(r *eventRepository) {
+		r.RowLevelSecurity = true
+	}
+}
+
+// WithArchive enables archival of streams into "<table>_archive" table (see
+// ArchiveMigrations). Archived events are transparently read by Get and List.
+func WithArchive() Option {
+	return func(r *eventRepository) {
+		r.Archival = true
+	}
+}
+
+// WithTruncation enables stream truncation with TruncateBefore, settings are
+// stored in "<table>_streams" table (see TruncationMigrations).
+func WithTruncation() Option {
+	return func(r *eventRepository) {
+		r.Truncation = true
+	}
+}
+
+// WithTimePartitions should be used with the event table partitioned by time
+// (see TimePartitionMigrations), appends to the stream are serialized with
+// the transaction advisory lock like WithAdvisoryLocks does. Idempotency keys
+// are locked as well, so they stay unique per tenant.
+func WithTimePartitions() Option {
+	return func(r *eventRepository) {
+		r.TimePartitions = true
+	}
+}
+
+// WithHashPartitions should be used with the event table partitioned by hash
+// (see HashPartitionMigrations). Idempotency keys are locked with the
+// transaction advisory lock, so they stay unique per tenant across
+// partitions.
+func WithHashPartitions() Option {
+	return func(r *eventRepository) {
+		r.HashPartitions = true
+	}
+}
+
+// WithReadReplica serves Get and List from the replica connection pool, the
+// primary pool passed to New serves writes. Reads of streams saved with the
+// version token of the context (see eventstore.WithVersionToken) are routed
+// to the primary.
+func WithReadReplica(replica *sql.DB) Option {
+	return func(r *eventRepository) {
+		r.Replica = sqlDB{replica}
+	}
+}
+
+// WithAdvisoryLocks serializes writers of every stream with the transaction
+// advisory lock, so appends, deletion, archival and truncation of the stream
+// don't interleave. Writers wait for the lock at most timeout (zero means no
+// timeout) and then fail with ErrLockTimeout. Writers which saved stale
+// versions still fail with ErrControlConcurrency after waiting, only
+// aggregates loaded under Lock don't conflict.
+func WithAdvisoryLocks(timeout time.Duration) Option {
+	return func(r *eventRepository) {
+		r.AdvisoryLocks = true
+		r.LockTimeout = timeout
+	}
+}
+
+// WithLogger sets logger of concurrency conflicts, lock timeouts, signature
+// verification failures and saves, nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *eventRepository) {
+		r.Logger = logger
+	}
+}
@@ -3,14 +3,12 @@ package postgresql
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"os"
 	"testing"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 	"github.com/stretchr/testify/assert"
@@ -18,9 +16,13 @@ import (
 	"github.com/0x9ef/eventsourcing-go"
 	"github.com/0x9ef/eventsourcing-go/event"
 	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/internal/pgtest"
 )
 
-var db *sql.DB
+var (
+	db     *sql.DB
+	dbPort string
+)
 
 func TestMain(m *testing.M) {
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
@@ -59,11 +61,11 @@ func TestMain(m *testing.M) {
 		log.Fatalf("failed to set expire timeout: %s", err)
 	}
 
-	resourcePort := postgres.GetPort("5432/tcp")
+	dbPort = postgres.GetPort("5432/tcp")
 	logger.Print("Trying to connect to database...")
 	if err := pool.Retry(func() error {
 		var err error
-		db, err = sql.Open("postgres", fmt.Sprintf("port=%s user=root password=root dbname=test sslmode=disable", resourcePort))
+		db, err = sql.Open("postgres", fmt.Sprintf("port=%s user=root password=root dbname=test sslmode=disable", dbPort))
 		if err != nil {
 			return err
 		}
@@ -76,6 +78,9 @@ func TestMain(m *testing.M) {
 	if err := New(db, "es_events").migrate(context.Background(), createMigrations); err != nil {
 		log.Fatalf("failed to migrate: %s", err)
 	}
+	if err := migrateSuite(context.Background()); err != nil {
+		log.Fatalf("failed to migrate: %s", err)
+	}
 
 	logger.Print("Running tests...")
 	exitCode := m.Run()
@@ -87,59 +92,13 @@ func TestMain(m *testing.M) {
 	os.Exit(exitCode)
 }
 
-type TestAggregator struct {
-	*eventsourcing.AggregateCluster
-	Status string
-}
-
-const (
-	testAggregateReasonCreated   = "created"
-	testAggregateReasonConfirmed = "confirmed"
-)
-
-func (ta *TestAggregator) Transition(evt event.Eventer) error {
-	switch evt.GetReason() {
-	case testAggregateReasonCreated:
-		return ta.onCreated(evt)
-	case testAggregateReasonConfirmed:
-		return ta.onConfirmed(evt)
-	}
-	return errors.New("undefined event type")
-}
-
-type eventTestCreated struct {
-	Status string
-}
-
-func (ta *TestAggregator) onCreated(evt event.Eventer) error {
-	var payload eventTestCreated
-	if err := json.Unmarshal(evt.GetPayload(), &payload); err != nil {
-		return err
-	}
-	ta.Status = payload.Status
-	return nil
-}
-
-type eventTestConfirmed struct {
-	Status string
-}
-
-func (ta *TestAggregator) onConfirmed(evt event.Eventer) error {
-	var payload eventTestConfirmed
-	if err := json.Unmarshal(evt.GetPayload(), &payload); err != nil {
-		return err
-	}
-	ta.Status = payload.Status
-	return nil
-}
-
 func TestSave(t *testing.T) {
-	agg := &TestAggregator{}
+	agg := &pgtest.TestAggregator{}
 	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
 
 	events := []*event.Event{
-		event.MustNew("created", eventTestCreated{Status: "Created"}),
-		event.MustNew("confirmed", eventTestConfirmed{Status: "Confirmed"}),
+		event.MustNew("created", pgtest.Created{Status: "Created"}),
+		event.MustNew("confirmed", pgtest.Confirmed{Status: "Confirmed"}),
 	}
 	for _, evt := range events {
 		err := root.Apply(evt)
@@ -152,12 +111,12 @@ func TestSave(t *testing.T) {
 }
 
 func TestGet(t *testing.T) {
-	agg := &TestAggregator{}
+	agg := &pgtest.TestAggregator{}
 	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
 
 	ctx := context.TODO()
 	repo := New(db, "es_events")
-	events, err := seedEvents(root, repo)
+	events, err := pgtest.SeedEvents(root, repo)
 	assert.NoError(t, err, "cannot seed events")
 
 	evt, err := repo.Get(ctx, events[1].GetAggregateId(), events[1].GetAggregateType(), events[1].GetVersion())
@@ -168,12 +127,12 @@ func TestGet(t *testing.T) {
 }
 
 func TestList(t *testing.T) {
-	agg := &TestAggregator{}
+	agg := &pgtest.TestAggregator{}
 	root := eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
 
 	ctx := context.TODO()
 	repo := New(db, "es_events")
-	events, err := seedEvents(root, repo)
+	events, err := pgtest.SeedEvents(root, repo)
 	assert.NoError(t, err, "cannot seed events")
 
 	type testCase struct {
@@ -231,17 +190,133 @@ func TestList(t *testing.T) {
 	}
 }
 
-func seedEvents(root *eventsourcing.AggregateCluster, repo *eventRepository) ([]*event.Event, error) {
-	events := []*event.Event{
-		event.MustNew("created", eventTestCreated{Status: "Created"}),
-		event.MustNew("confirmed", eventTestConfirmed{Status: "Confirmed"}),
+// migrateSuite creates tables used by TestSubjectKeyStore and the shared
+// suite next to the event table.
+func migrateSuite(ctx context.Context) error {
+	cfg := Config{Schema: "public", Table: "es_events"}
+	subjectKeyMigrations, err := SubjectKeyMigrations("public.es_subject_keys")
+	if err != nil {
+		return err
 	}
-	for _, evt := range events {
-		err := root.Apply(evt)
-		if err != nil {
-			return nil, err
+	for _, stmts := range [][]string{subjectKeyMigrations, ArchiveMigrations(cfg), TruncationMigrations(cfg)} {
+		if err := Migrate(ctx, db, stmts); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func TestSubjectKeyStore(t *testing.T) {
+	ctx := context.TODO()
+	keys := NewSubjectKeyStore(db, "es_subject_keys")
+
+	key, err := keys.CreateKey(ctx, "customer_0")
+	assert.NoError(t, err, "failed to create key")
+	assert.Equal(t, 32, len(key))
+
+	again, err := keys.CreateKey(ctx, "customer_0")
+	assert.NoError(t, err, "failed to create key")
+	assert.Equal(t, key, again, "key must be created only once")
+
+	err = keys.Delete(ctx, "customer_0")
+	assert.NoError(t, err, "failed to delete key")
+
+	_, err = keys.Key(ctx, "customer_0")
+	assert.Equal(t, event.ErrDataShredded, err)
+	_, err = keys.CreateKey(ctx, "customer_0")
+	assert.Equal(t, event.ErrDataShredded, err)
+
+	_, err = SubjectKeyMigrations("es_subject_keys; DROP TABLE es_events")
+	assert.Equal(t, ErrInvalidTableName, err)
+}
+
+func TestSuite(t *testing.T) {
+	pgtest.RunSuite(t, pgtest.Store{Port: dbPort, New: newSuiteRepository})
+}
+
+// newSuiteRepository returns repository of the config adapted to the shared
+// suite of the PostgreSQL stores.
+func newSuiteRepository(t *testing.T, cfg Config, opts pgtest.Options) pgtest.Repository {
+	conn := db
+	if opts.User != "" {
+		conn = openSuiteDB(t, pgtest.DSN(dbPort, opts.User, opts.Password, "test"))
+	}
+
+	var options []Option
+	if opts.Replica != "" {
+		options = append(options, WithReadReplica(openSuiteDB(t, pgtest.DSN(dbPort, "root", "root", opts.Replica))))
+	}
+	if opts.TenantTables != nil {
+		options = append(options, WithTenantTables(opts.TenantTables))
+	}
+	if opts.RowLevelSecurity {
+		options = append(options, WithRowLevelSecurity())
+	}
+	if opts.Archive {
+		options = append(options, WithArchive())
+	}
+	if opts.Truncation {
+		options = append(options, WithTruncation())
+	}
+	if opts.TimePartitions {
+		options = append(options, WithTimePartitions())
+	}
+	if opts.HashPartitions {
+		options = append(options, WithHashPartitions())
+	}
+	if opts.AdvisoryLocks {
+		options = append(options, WithAdvisoryLocks(opts.LockTimeout))
+	}
+	if opts.Signer != nil {
+		options = append(options, WithSigner(opts.Signer))
+	}
+	if opts.Verifier != nil {
+		options = append(options, WithSignatureVerifier(opts.Verifier, opts.StrictSignatures))
+	}
+	if opts.Logger != nil {
+		options = append(options, WithLogger(opts.Logger))
+	}
+	return suiteRepository{NewWithConfig(conn, cfg, options...)}
+}
+
+func openSuiteDB(t *testing.T, dsn string) *sql.DB {
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+type suiteRepository struct {
+	*eventRepository
+}
+
+func (r suiteRepository) Lock(ctx context.Context, aggregateID, aggregateType string) (context.Context, pgtest.StreamLock, error) {
+	lockCtx, lock, err := r.eventRepository.Lock(ctx, aggregateID, aggregateType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lockCtx, lock, nil
+}
+
+func (r suiteRepository) EnsurePartitions(ctx context.Context, ahead int) error {
+	return NewPartitioner(r.eventRepository, ahead).EnsurePartitions(ctx)
+}
+
+func (r suiteRepository) Scavenge(ctx context.Context, batchSize int) (int64, error) {
+	return NewScavenger(r.eventRepository, batchSize).Scavenge(ctx)
+}
+
+func (r suiteRepository) Compactor(batchSize int, rules ...RetentionRule) pgtest.Compactor {
+	return NewCompactor(r.eventRepository, batchSize, rules...)
+}
+
+func TestErrorCode(t *testing.T) {
+	code, constraint := pqDriver{}.ErrorCode(fmt.Errorf("insert: %w", &pq.Error{Code: "23505", Constraint: "id_type_version_un"}))
+	assert.Equal(t, "23505", code)
+	assert.Equal(t, "id_type_version_un", constraint)
 
-	return events, repo.Save(context.TODO(), event.Covarience(events))
+	code, _ = pqDriver{}.ErrorCode(sql.ErrNoRows)
+	assert.Equal(t, "", code, "errors of database/sql have no code")
 }
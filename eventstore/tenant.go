@@ -0,0 +1,51 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+var ErrTenantMismatch = errors.New("event belongs to another tenant")
+
+type tenantKey struct{}
+
+// WithTenant returns context scoped to the tenant. Repositories read and
+// write only events of the tenant from context, context without tenant is
+// scoped to the default (empty) tenant.
+func WithTenant(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantId)
+}
+
+// TenantFromContext returns tenant the context is scoped to.
+func TenantFromContext(ctx context.Context) string {
+	tenantId, _ := ctx.Value(tenantKey{}).(string)
+	return tenantId
+}
+
+// ScopeTenant assigns tenant from context to events without tenant and
+// returns ErrTenantMismatch if any event belongs to another tenant. Events
+// are left untouched on mismatch.
+func ScopeTenant(ctx context.Context, events []event.Eventer) error {
+	return ScopeTenantStreams(ctx, [][]event.Eventer{events})
+}
+
+// ScopeTenantStreams scopes events of all streams like ScopeTenant, no
+// events are modified if any stream belongs to another tenant.
+func ScopeTenantStreams(ctx context.Context, streams [][]event.Eventer) error {
+	tenantId := TenantFromContext(ctx)
+	for _, events := range streams {
+		for _, evt := range events {
+			if evt.GetTenantId() != "" && evt.GetTenantId() != tenantId {
+				return ErrTenantMismatch
+			}
+		}
+	}
+	for _, events := range streams {
+		for _, evt := range events {
+			evt.SetTenantId(tenantId)
+		}
+	}
+	return nil
+}
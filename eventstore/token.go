@@ -0,0 +1,76 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+// VersionToken tracks the last versions of streams saved by the caller.
+// Repositories reading from replicas route reads of such streams to the
+// primary, so the caller always reads its own writes.
+type VersionToken struct {
+	mu       sync.Mutex
+	versions map[tokenStream]event.Version
+}
+
+type tokenStream struct {
+	tenantId      string
+	aggregateId   string
+	aggregateType string
+}
+
+func NewVersionToken() *VersionToken {
+	return &VersionToken{versions: make(map[tokenStream]event.Version)}
+}
+
+// Record records the last saved version of the stream.
+func (t *VersionToken) Record(tenantId, aggregateId, aggregateType string, version event.Version) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := tokenStream{tenantId, aggregateId, aggregateType}
+	if version > t.versions[key] {
+		t.versions[key] = version
+	}
+}
+
+// Version returns the last version of the stream saved with the token, or
+// EmptyVersion if the stream wasn't saved.
+func (t *VersionToken) Version(tenantId, aggregateId, aggregateType string) event.Version {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	version, ok := t.versions[tokenStream{tenantId, aggregateId, aggregateType}]
+	if !ok {
+		return event.EmptyVersion
+	}
+	return version
+}
+
+type versionTokenKey struct{}
+
+// WithVersionToken returns context with the version token. Saves with the
+// context are recorded into the token.
+func WithVersionToken(ctx context.Context, token *VersionToken) context.Context {
+	return context.WithValue(ctx, versionTokenKey{}, token)
+}
+
+// VersionTokenFromContext returns version token of the context or nil.
+func VersionTokenFromContext(ctx context.Context) *VersionToken {
+	token, _ := ctx.Value(versionTokenKey{}).(*VersionToken)
+	return token
+}
+
+// RecordVersions records the last versions of saved streams into the version
+// token of the context, if any.
+func RecordVersions(ctx context.Context, events []event.Eventer) {
+	token := VersionTokenFromContext(ctx)
+	if token == nil {
+		return
+	}
+	for _, evt := range events {
+		token.Record(evt.GetTenantId(), evt.GetAggregateId(), evt.GetAggregateType(), evt.GetVersion())
+	}
+}
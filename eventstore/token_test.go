@@ -0,0 +1,37 @@
+package eventstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+func TestVersionToken(t *testing.T) {
+	ctx := context.TODO()
+	RecordVersions(ctx, []event.Eventer{event.MustNew("created", nil)})
+
+	token := NewVersionToken()
+	ctx = WithVersionToken(ctx, token)
+	assert.Equal(t, token, VersionTokenFromContext(ctx))
+
+	events := make([]event.Eventer, 2)
+	for i := range events {
+		evt := event.MustNew("created", nil)
+		evt.SetTenantId("tenant_a")
+		evt.SetAggregateId("agg_0")
+		evt.SetAggregateType("TestAggregator")
+		evt.SetVersion(event.Version(i + 1))
+		events[i] = evt
+	}
+	RecordVersions(ctx, events)
+
+	assert.Equal(t, event.Version(2), token.Version("tenant_a", "agg_0", "TestAggregator"))
+	assert.Equal(t, event.EmptyVersion, token.Version("", "agg_0", "TestAggregator"))
+
+	// Older versions don't move token back
+	token.Record("tenant_a", "agg_0", "TestAggregator", 1)
+	assert.Equal(t, event.Version(2), token.Version("tenant_a", "agg_0", "TestAggregator"))
+}
@@ -0,0 +1,70 @@
+package eventstore
+
+import (
+	"context"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+// UnitOfWork collects uncommitted events of several aggregates and saves
+// them atomically, e.g. when a single command modifies both payment and
+// ledger aggregates.
+type UnitOfWork struct {
+	repo       MultiSaver
+	aggregates []event.Aggregator
+}
+
+func NewUnitOfWork(repo MultiSaver) *UnitOfWork {
+	return &UnitOfWork{repo: repo}
+}
+
+// Register adds aggregates to the unit of work. Registering the same
+// aggregate twice has no effect.
+func (u *UnitOfWork) Register(aggs ...event.Aggregator) {
+	for _, agg := range aggs {
+		if !u.registered(agg) {
+			u.aggregates = append(u.aggregates, agg)
+		}
+	}
+}
+
+func (u *UnitOfWork) registered(agg event.Aggregator) bool {
+	for _, registered := range u.aggregates {
+		if registered == agg {
+			return true
+		}
+	}
+	return false
+}
+
+// Commit saves uncommitted events of all registered aggregates in one
+// transaction. Events are marked as committed in their aggregates only
+// when the whole transaction succeeded. The unit of work is reset after
+// a successful commit and can be reused.
+func (u *UnitOfWork) Commit(ctx context.Context) error {
+	streams := make([][]event.Eventer, 0, len(u.aggregates))
+	for _, agg := range u.aggregates {
+		if events := agg.ListUncommittedEvents(); len(events) != 0 {
+			streams = append(streams, events)
+		}
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+
+	if err := u.repo.SaveMulti(ctx, streams); err != nil {
+		return err
+	}
+
+	for i, agg := range u.aggregates {
+		for _, evt := range agg.ListUncommittedEvents() {
+			if err := agg.Commit(evt); err != nil {
+				return err
+			}
+		}
+		u.aggregates[i] = nil
+	}
+	u.aggregates = u.aggregates[:0]
+
+	return nil
+}
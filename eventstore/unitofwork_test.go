@@ -0,0 +1,88 @@
+package eventstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/memory"
+)
+
+type BalanceAggregator struct {
+	*eventsourcing.AggregateCluster
+	Balance int
+}
+
+type balanceChangedEvent struct {
+	Amount int
+}
+
+func (ba *BalanceAggregator) Transition(evt event.Eventer) error {
+	switch evt.GetReason() {
+	case "changed":
+		var payload balanceChangedEvent
+		if err := event.Decode(evt, &payload); err != nil {
+			return err
+		}
+		ba.Balance += payload.Amount
+		return nil
+	}
+	return errors.New("undefined event type")
+}
+
+func newBalance() *BalanceAggregator {
+	agg := &BalanceAggregator{}
+	agg.AggregateCluster = eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	return agg
+}
+
+func TestUnitOfWorkCommit(t *testing.T) {
+	ctx := context.TODO()
+	repo := memory.New()
+
+	payment, ledger := newBalance(), newBalance()
+	assert.NoError(t, payment.Apply(event.MustNew("changed", balanceChangedEvent{Amount: -100})))
+	assert.NoError(t, ledger.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 100})))
+
+	uow := eventstore.NewUnitOfWork(repo)
+	uow.Register(payment, ledger, payment)
+	err := uow.Commit(ctx)
+	assert.NoError(t, err, "failed to commit unit of work")
+
+	assert.Equal(t, 0, len(payment.ListUncommittedEvents()))
+	assert.Equal(t, 0, len(ledger.ListUncommittedEvents()))
+
+	for _, agg := range []*BalanceAggregator{payment, ledger} {
+		events, err := repo.List(ctx, agg.GetId(), agg.GetType(), nil)
+		assert.NoError(t, err, "failed to list events")
+		assert.Equal(t, 1, len(events))
+	}
+}
+
+func TestUnitOfWorkCommitConflict(t *testing.T) {
+	ctx := context.TODO()
+	repo := memory.New()
+
+	payment, ledger := newBalance(), newBalance()
+	assert.NoError(t, ledger.Apply(event.MustNew("changed", balanceChangedEvent{Amount: 100})))
+	assert.NoError(t, repo.Save(ctx, ledger.ListUncommittedEvents()))
+
+	// Ledger was not reloaded, so its uncommitted event conflicts
+	// with the already saved one.
+	assert.NoError(t, payment.Apply(event.MustNew("changed", balanceChangedEvent{Amount: -100})))
+
+	uow := eventstore.NewUnitOfWork(repo)
+	uow.Register(payment, ledger)
+	err := uow.Commit(ctx)
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+
+	assert.Equal(t, 1, len(payment.ListUncommittedEvents()), "events must stay uncommitted")
+	events, err := repo.List(ctx, payment.GetId(), payment.GetType(), nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Equal(t, 0, len(events))
+}
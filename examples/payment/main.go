@@ -95,34 +95,10 @@ func main() {
 		panic(err)
 	}
 
-	// Define and apply SQL migrations
-	migrations := []string{
-		`CREATE TABLE public.es_events (
-			aggregate_id   VARCHAR(128) NOT NULL,
-			aggregate_type VARCHAR(128) NOT NULL,
-			reason         TEXT NOT NULL,
-			version        SMALLINT NOT NULL,
-			tstamp         TIMESTAMPTZ NOT NULL,
-			payload        bytea,
-			serializer     VARCHAR(16)
-		);`,
-		"CREATE UNIQUE INDEX id_type_version_un ON public.es_events (aggregate_id, aggregate_type, version);",
-		"CREATE INDEX id_type_idx ON public.es_events (aggregate_id, aggregate_type);",
-	}
-
+	// Apply SQL migrations of the events table
 	ctx := context.TODO()
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		panic(err)
-	}
-	defer tx.Rollback()
-
-	for _, stmt := range migrations {
-		if _, err := tx.Exec(stmt); err != nil {
-			panic(err)
-		}
-	}
-	if err := tx.Commit(); err != nil {
+	migrations := postgresql.CreateMigrations(postgresql.Config{Schema: "public", Table: "es_events"})
+	if err := postgresql.Migrate(ctx, db, migrations); err != nil {
 		panic(err)
 	}
 
@@ -0,0 +1,41 @@
+// Package logging holds helpers shared by loggers of aggregates and event
+// stores.
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/0x9ef/eventsourcing-go/event"
+)
+
+// Discard returns logger which drops all records, it's the default logger of
+// aggregates and stores.
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// StreamAttrs are logged with every record about the stream.
+func StreamAttrs(tenantId, aggregateId, aggregateType string, version event.Version) []slog.Attr {
+	return []slog.Attr{
+		slog.String("tenant_id", tenantId),
+		slog.String("aggregate_id", aggregateId),
+		slog.String("aggregate_type", aggregateType),
+		slog.Int("version", int(version)),
+	}
+}
+
+// EventsAttrs are logged with records about saved events of the stream,
+// version is the version of the last event.
+func EventsAttrs(events []event.Eventer) []slog.Attr {
+	last := events[len(events)-1]
+	return append(StreamAttrs(last.GetTenantId(), last.GetAggregateId(), last.GetAggregateType(), last.GetVersion()),
+		slog.Int("count", len(events)))
+}
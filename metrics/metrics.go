@@ -0,0 +1,152 @@
+// Package metrics exposes Prometheus collectors for event stores, aggregates
+// and projections.
+//
+//	m := metrics.New("payments")
+//	prometheus.MustRegister(m)
+//
+//	repo := middleware.Wrap(postgresql.New(db, "es_events"), m.Middleware())
+//	agg.AggregateCluster = eventsourcing.New(agg, agg.Transition, eventsourcing.UUIDGenerator, m.AggregateOption())
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/middleware"
+)
+
+// Metrics is a set of Prometheus collectors, it's registered as a single
+// collector.
+type Metrics struct {
+	callDuration   *prometheus.HistogramVec
+	callErrors     *prometheus.CounterVec
+	conflicts      *prometheus.CounterVec
+	eventsApplied  *prometheus.CounterVec
+	projectionLag  *prometheus.GaugeVec
+	projectedTotal *prometheus.CounterVec
+}
+
+var _ (prometheus.Collector) = &Metrics{}
+
+// New returns collectors with metric names prefixed by namespace.
+func New(namespace string) *Metrics {
+	return &Metrics{
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "eventstore",
+			Name:      "call_duration_seconds",
+			Help:      "Duration of event store calls.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "aggregate_type"}),
+		callErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "eventstore",
+			Name:      "call_errors_total",
+			Help:      "Number of failed event store calls.",
+		}, []string{"method", "aggregate_type"}),
+		conflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "eventstore",
+			Name:      "concurrency_conflicts_total",
+			Help:      "Number of saves failed with optimistic concurrency conflict.",
+		}, []string{"aggregate_type"}),
+		eventsApplied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "aggregate",
+			Name:      "events_applied_total",
+			Help:      "Number of events applied into aggregates.",
+		}, []string{"aggregate_type", "reason", "committed"}),
+		projectionLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "projection",
+			Name:      "lag_seconds",
+			Help:      "Time between the last projected event was created and projected.",
+		}, []string{"projection"}),
+		projectedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "projection",
+			Name:      "events_projected_total",
+			Help:      "Number of projected events.",
+		}, []string{"projection"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.callDuration,
+		m.callErrors,
+		m.conflicts,
+		m.eventsApplied,
+		m.projectionLag,
+		m.projectedTotal,
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Middleware observes latency and errors of repository calls and counts
+// concurrency conflicts, see middleware.Wrap.
+func (m *Metrics) Middleware() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, op middleware.Op) error {
+			start := time.Now()
+			err := next(ctx, op)
+
+			m.callDuration.WithLabelValues(op.Method, op.AggregateType).Observe(time.Since(start).Seconds())
+			if err != nil {
+				m.callErrors.WithLabelValues(op.Method, op.AggregateType).Inc()
+			}
+			if errors.Is(err, eventstore.ErrControlConcurrency) {
+				m.conflicts.WithLabelValues(conflictType(op, err)).Inc()
+			}
+			return err
+		}
+	}
+}
+
+// conflictType returns type of the conflicting stream, calls spanning
+// several streams such as SaveMulti have no type in op.
+func conflictType(op middleware.Op, err error) string {
+	var conflict *eventstore.ConcurrencyError
+	if errors.As(err, &conflict) {
+		return conflict.AggregateType
+	}
+	return op.AggregateType
+}
+
+// AggregateOption counts events applied into the aggregate by reason.
+func (m *Metrics) AggregateOption() eventsourcing.Option {
+	return eventsourcing.WithApplyHook(func(evt event.Eventer, committed bool) {
+		m.eventsApplied.WithLabelValues(evt.GetAggregateType(), evt.GetReason(), committedLabel(committed)).Inc()
+	})
+}
+
+func committedLabel(committed bool) string {
+	if committed {
+		return "true"
+	}
+	return "false"
+}
+
+// ObserveProjected records event handled by the projection, projection lag
+// is time passed since the event was created.
+func (m *Metrics) ObserveProjected(projection string, evt event.Eventer) {
+	m.projectedTotal.WithLabelValues(projection).Inc()
+	m.projectionLag.WithLabelValues(projection).Set(time.Since(time.Time(evt.GetTimestamp())).Seconds())
+}
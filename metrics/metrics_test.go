@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/memory"
+	"github.com/0x9ef/eventsourcing-go/eventstore/middleware"
+)
+
+type TestAggregator struct {
+	*eventsourcing.AggregateCluster
+}
+
+func (ta *TestAggregator) Transition(evt event.Eventer) error {
+	if evt.GetReason() != "created" {
+		return errors.New("undefined event type")
+	}
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	m := New("test")
+	registry := prometheus.NewPedanticRegistry()
+	assert.NoError(t, registry.Register(m), "failed to register collectors")
+
+	ctx := context.TODO()
+	repo := middleware.Wrap(memory.New(), m.Middleware())
+
+	agg := &TestAggregator{}
+	agg.AggregateCluster = eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator, m.AggregateOption())
+	assert.NoError(t, agg.Apply(event.MustNew("created", struct{}{})))
+	assert.NoError(t, repo.Save(ctx, agg.ListUncommittedEvents()))
+
+	// Stale batch conflicts with the saved one
+	err := repo.Save(ctx, agg.ListUncommittedEvents())
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+
+	events, err := repo.List(ctx, agg.GetId(), agg.GetType(), nil)
+	assert.NoError(t, err, "failed to list events")
+	m.ObserveProjected("balances", events[0])
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.eventsApplied.WithLabelValues("TestAggregator", "created", "false")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.conflicts.WithLabelValues("TestAggregator")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.callErrors.WithLabelValues("Save", "TestAggregator")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.projectedTotal.WithLabelValues("balances")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.callDuration))
+
+	_, err = registry.Gather()
+	assert.NoError(t, err, "failed to gather metrics")
+}
+
+func TestMetricsSaveMultiConflict(t *testing.T) {
+	m := New("test")
+	ctx := context.TODO()
+	repo := middleware.Wrap(memory.New(), m.Middleware())
+
+	agg := &TestAggregator{}
+	agg.AggregateCluster = eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator)
+	assert.NoError(t, agg.Apply(event.MustNew("created", struct{}{})))
+	assert.NoError(t, repo.Save(ctx, agg.ListUncommittedEvents()))
+
+	err := repo.SaveMulti(ctx, [][]event.Eventer{agg.ListUncommittedEvents()})
+	assert.ErrorIs(t, err, eventstore.ErrControlConcurrency)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.conflicts.WithLabelValues("TestAggregator")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.conflicts.WithLabelValues("")))
+}
@@ -0,0 +1,293 @@
+// Package tracing traces loading of aggregates, Transition calls and
+// repository calls with OpenTelemetry. Trace context is propagated into
+// metadata of saved events, so consumers reading the events can continue
+// the trace.
+//
+//	t := tracing.New()
+//	repo := t.Wrap(postgresql.New(db, "es_events"))
+//	agg.AggregateCluster = eventsourcing.New(agg, agg.Transition, eventsourcing.UUIDGenerator, t.AggregateOption())
+//
+//	err := t.Load(ctx, repo, agg, aggregateID, "PaymentAggregator")
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/middleware"
+)
+
+const instrumentationName = "github.com/0x9ef/eventsourcing-go"
+
+// Attribute keys of recorded spans.
+const (
+	AggregateIdKey      = attribute.Key("eventsourcing.aggregate.id")
+	AggregateTypeKey    = attribute.Key("eventsourcing.aggregate.type")
+	AggregateVersionKey = attribute.Key("eventsourcing.aggregate.version")
+	ReasonKey           = attribute.Key("eventsourcing.event.reason")
+	MethodKey           = attribute.Key("eventsourcing.eventstore.method")
+)
+
+// Tracer records spans of aggregates and repositories.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+type Option func(t *Tracer)
+
+// WithTracerProvider sets provider of the tracer, the global provider is used
+// by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(t *Tracer) {
+		t.tracer = provider.Tracer(instrumentationName)
+	}
+}
+
+// WithPropagator sets propagator of trace context into event metadata, W3C
+// trace context is used by default.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(t *Tracer) {
+		t.propagator = propagator
+	}
+}
+
+func New(opts ...Option) *Tracer {
+	t := &Tracer{
+		tracer:     otel.GetTracerProvider().Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Inject writes trace context of ctx into event metadata.
+func (t *Tracer) Inject(ctx context.Context, evt event.Eventer) {
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return
+	}
+
+	metadata := make(event.Metadata, len(evt.GetMetadata())+len(carrier))
+	for k, v := range evt.GetMetadata() {
+		metadata[k] = v
+	}
+	for k, v := range carrier {
+		metadata[k] = v
+	}
+	evt.SetMetadata(metadata)
+}
+
+// Extract returns ctx with trace context read from event metadata, e.g. to
+// continue the trace in the consumer of the event.
+func (t *Tracer) Extract(ctx context.Context, evt event.Eventer) context.Context {
+	return t.propagator.Extract(ctx, propagation.MapCarrier(evt.GetMetadata()))
+}
+
+func (t *Tracer) traced(evt event.Eventer) bool {
+	return trace.SpanContextFromContext(t.Extract(context.Background(), evt)).IsValid()
+}
+
+// AggregateOption traces every Transition call of the aggregate. Spans are
+// children of the context passed to ApplyContext or ApplyCommittedContext.
+// Uncommitted events applied within a trace get trace context of their
+// Transition span, committed events are linked to the trace they were saved
+// in.
+func (t *Tracer) AggregateOption() eventsourcing.Option {
+	return func(agg *eventsourcing.AggregateCluster) {
+		eventsourcing.WithTransitionInterceptor(func(ctx context.Context, evt event.Eventer, committed bool, transition func() error) error {
+			return t.transition(ctx, agg, evt, committed, transition)
+		})(agg)
+	}
+}
+
+func (t *Tracer) transition(ctx context.Context, agg *eventsourcing.AggregateCluster, evt event.Eventer, committed bool, transition func() error) error {
+	// Uncommitted event gets its aggregate and version after the transition
+	id, typ, version := agg.GetId(), agg.GetType(), agg.GetVersion()+event.NextVersion
+	if committed {
+		id, typ, version = evt.GetAggregateId(), evt.GetAggregateType(), evt.GetVersion()
+	}
+
+	opts := []trace.SpanStartOption{trace.WithAttributes(
+		AggregateIdKey.String(id),
+		AggregateTypeKey.String(typ),
+		AggregateVersionKey.Int64(int64(version)),
+		ReasonKey.String(evt.GetReason()),
+		attribute.Bool("eventsourcing.event.committed", committed),
+	)}
+	if committed {
+		if link := trace.SpanContextFromContext(t.Extract(context.Background(), evt)); link.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: link}))
+		}
+	}
+
+	// Event applied without trace is left to the save span
+	parent := trace.SpanContextFromContext(ctx)
+
+	ctx, span := t.tracer.Start(ctx, "eventsourcing.Transition", opts...)
+	defer span.End()
+
+	if !committed && parent.IsValid() && !t.traced(evt) {
+		t.Inject(ctx, evt)
+	}
+	return record(span, transition())
+}
+
+// Load applies committed events of the stream into the aggregate within the
+// load span. Empty stream is eventstore.ErrEventNotFound.
+func (t *Tracer) Load(ctx context.Context, repo eventstore.Repository, agg event.Aggregator, aggregateID, aggregateType string) error {
+	ctx, span := t.tracer.Start(ctx, "eventsourcing.Load", trace.WithAttributes(
+		AggregateIdKey.String(aggregateID),
+		AggregateTypeKey.String(aggregateType),
+	))
+	defer span.End()
+
+	events, err := repo.List(ctx, aggregateID, aggregateType, nil)
+	if err != nil {
+		return record(span, err)
+	}
+	if len(events) == 0 {
+		return record(span, eventstore.ErrEventNotFound)
+	}
+
+	applier, hasContext := agg.(interface {
+		ApplyCommittedContext(ctx context.Context, evt event.Eventer) error
+	})
+	for _, evt := range events {
+		if hasContext {
+			err = applier.ApplyCommittedContext(ctx, evt)
+		} else {
+			err = agg.ApplyCommitted(evt)
+		}
+		if err != nil {
+			return record(span, err)
+		}
+	}
+
+	span.SetAttributes(AggregateVersionKey.Int64(int64(agg.GetVersion())))
+	return nil
+}
+
+// Middleware records span of every repository call.
+func (t *Tracer) Middleware() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, op middleware.Op) error {
+			attrs := []attribute.KeyValue{MethodKey.String(op.Method)}
+			if op.AggregateId != "" {
+				attrs = append(attrs, AggregateIdKey.String(op.AggregateId))
+			}
+			if op.AggregateType != "" {
+				attrs = append(attrs, AggregateTypeKey.String(op.AggregateType))
+			}
+
+			ctx, span := t.tracer.Start(ctx, "eventstore."+op.Method, trace.WithAttributes(attrs...))
+			defer span.End()
+
+			return record(span, next(ctx, op))
+		}
+	}
+}
+
+// Wrap traces every call of repo. Saved events without trace context get
+// trace context of the save span. Returned repository implements all
+// optional repository interfaces, see middleware.Wrap.
+func (t *Tracer) Wrap(repo eventstore.Repository) eventstore.Repository {
+	return middleware.Wrap(&propagatingRepository{Repository: repo, tracer: t}, t.Middleware())
+}
+
+type propagatingRepository struct {
+	eventstore.Repository
+	tracer *Tracer
+}
+
+func (r *propagatingRepository) inject(ctx context.Context, events []event.Eventer) {
+	for _, evt := range events {
+		if !r.tracer.traced(evt) {
+			r.tracer.Inject(ctx, evt)
+		}
+	}
+}
+
+func (r *propagatingRepository) Save(ctx context.Context, events []event.Eventer) error {
+	r.inject(ctx, events)
+	return r.Repository.Save(ctx, events)
+}
+
+func (r *propagatingRepository) SaveMulti(ctx context.Context, streams [][]event.Eventer) error {
+	saver, ok := r.Repository.(eventstore.MultiSaver)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	for _, events := range streams {
+		r.inject(ctx, events)
+	}
+	return saver.SaveMulti(ctx, streams)
+}
+
+func (r *propagatingRepository) SaveIdempotent(ctx context.Context, events []event.Eventer) (bool, error) {
+	saver, ok := r.Repository.(eventstore.IdempotentSaver)
+	if !ok {
+		return false, eventstore.ErrNotSupported
+	}
+	r.inject(ctx, events)
+	return saver.SaveIdempotent(ctx, events)
+}
+
+func (r *propagatingRepository) Verify(ctx context.Context, aggregateID, aggregateType string) error {
+	verifier, ok := r.Repository.(eventstore.Verifier)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return verifier.Verify(ctx, aggregateID, aggregateType)
+}
+
+func (r *propagatingRepository) SoftDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	deleter, ok := r.Repository.(eventstore.StreamDeleter)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return deleter.SoftDelete(ctx, aggregateID, aggregateType)
+}
+
+func (r *propagatingRepository) HardDelete(ctx context.Context, aggregateID, aggregateType string) error {
+	deleter, ok := r.Repository.(eventstore.StreamDeleter)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return deleter.HardDelete(ctx, aggregateID, aggregateType)
+}
+
+func (r *propagatingRepository) Archive(ctx context.Context, aggregateID, aggregateType string) error {
+	archiver, ok := r.Repository.(eventstore.Archiver)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return archiver.Archive(ctx, aggregateID, aggregateType)
+}
+
+func (r *propagatingRepository) TruncateBefore(ctx context.Context, aggregateID, aggregateType string, version event.Version) error {
+	truncater, ok := r.Repository.(eventstore.Truncater)
+	if !ok {
+		return eventstore.ErrNotSupported
+	}
+	return truncater.TruncateBefore(ctx, aggregateID, aggregateType, version)
+}
+
+func record(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/0x9ef/eventsourcing-go"
+	"github.com/0x9ef/eventsourcing-go/event"
+	"github.com/0x9ef/eventsourcing-go/eventstore"
+	"github.com/0x9ef/eventsourcing-go/eventstore/memory"
+)
+
+type BalanceAggregator struct {
+	*eventsourcing.AggregateCluster
+	Balance int
+}
+
+type balanceDeposited struct {
+	Amount int
+}
+
+func (ba *BalanceAggregator) Transition(evt event.Eventer) error {
+	if evt.GetReason() != "deposited" {
+		return errors.New("undefined event type")
+	}
+	var payload balanceDeposited
+	if err := json.Unmarshal(evt.GetPayload(), &payload); err != nil {
+		return err
+	}
+	ba.Balance += payload.Amount
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tr := New(WithTracerProvider(provider))
+
+	repo := tr.Wrap(memory.New())
+	newfn := func() *BalanceAggregator {
+		agg := &BalanceAggregator{}
+		agg.AggregateCluster = eventsourcing.New(agg, agg.Transition, eventsourcing.NanoidGenerator, tr.AggregateOption())
+		return agg
+	}
+
+	ctx, cmd := provider.Tracer("test").Start(context.TODO(), "deposit")
+	agg := newfn()
+	assert.NoError(t, agg.ApplyContext(ctx, event.MustNew("deposited", balanceDeposited{Amount: 10})))
+	assert.NoError(t, agg.Apply(event.MustNew("deposited", balanceDeposited{Amount: 5})))
+	assert.NoError(t, repo.Save(ctx, agg.ListUncommittedEvents()))
+	cmd.End()
+
+	// Both events continue the command trace, the one applied without
+	// context gets trace context of the save span
+	events, err := repo.List(context.TODO(), agg.GetId(), agg.GetType(), nil)
+	assert.NoError(t, err, "failed to list events")
+	assert.Len(t, events, 2)
+	for _, evt := range events {
+		sc := trace.SpanContextFromContext(tr.Extract(context.TODO(), evt))
+		assert.Equal(t, cmd.SpanContext().TraceID(), sc.TraceID())
+	}
+
+	loaded := newfn()
+	assert.NoError(t, tr.Load(context.TODO(), repo, loaded, agg.GetId(), agg.GetType()))
+	assert.Equal(t, 15, loaded.Balance)
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{
+		"eventsourcing.Transition",
+		"eventsourcing.Transition",
+		"eventstore.Save",
+		"deposit",
+		"eventstore.List",
+		"eventstore.List",
+		"eventsourcing.Transition",
+		"eventsourcing.Transition",
+		"eventsourcing.Load",
+	}, names)
+
+	// Transitions of the load are linked to the trace events were saved in
+	load := recorder.Ended()[len(names)-1]
+	transition := recorder.Ended()[len(names)-2]
+	assert.Equal(t, load.SpanContext().SpanID(), transition.Parent().SpanID())
+	assert.Len(t, transition.Links(), 1)
+	assert.Equal(t, cmd.SpanContext().TraceID(), transition.Links()[0].SpanContext.TraceID())
+
+	err = tr.Load(context.TODO(), repo, newfn(), "unknown", agg.GetType())
+	assert.Error(t, err, "empty stream must not be loaded")
+}
+
+func TestWrapOptionalInterfaces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tr := New(WithTracerProvider(provider))
+	ctx := context.TODO()
+
+	repo := tr.Wrap(memory.New())
+	evt := event.MustNew("deposited", balanceDeposited{Amount: 10})
+	evt.SetAggregateId("agg_0")
+	evt.SetAggregateType("BalanceAggregator")
+	evt.SetVersion(1)
+	assert.NoError(t, repo.Save(ctx, []event.Eventer{evt}))
+
+	verifier, ok := repo.(eventstore.Verifier)
+	assert.True(t, ok, "wrapped repository must implement Verifier")
+	assert.NoError(t, verifier.Verify(ctx, "agg_0", "BalanceAggregator"))
+
+	deleter, ok := repo.(eventstore.StreamDeleter)
+	assert.True(t, ok, "wrapped repository must implement StreamDeleter")
+	assert.NoError(t, deleter.HardDelete(ctx, "agg_0", "BalanceAggregator"))
+
+	ended := recorder.Ended()
+	assert.Equal(t, "eventstore.HardDelete", ended[len(ended)-1].Name())
+}